@@ -0,0 +1,155 @@
+package kvtests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/visvasity/kv"
+)
+
+// CommitContentionWriters and CommitContentionHotKeys are the numbers of
+// concurrent writers and hot keys swept by BenchmarkCommitContention.
+var (
+	CommitContentionWriters = []int{1, 2, 4, 8, 16}
+	CommitContentionHotKeys = []int{1, 10, 100}
+)
+
+// BenchmarkCommitContention runs RunCommitContention as a sub-benchmark for
+// every combination of CommitContentionWriters and CommitContentionHotKeys.
+// It is the performance counterpart of TestConflictingTransactionCommit.
+func BenchmarkCommitContention(ctx context.Context, b *testing.B, db kv.Database) {
+	for _, hotKeys := range CommitContentionHotKeys {
+		for _, writers := range CommitContentionWriters {
+			b.Run(fmt.Sprintf("hotkeys=%d/writers=%d", hotKeys, writers), func(b *testing.B) {
+				RunCommitContention(ctx, b, db, writers, hotKeys)
+			})
+		}
+	}
+}
+
+// RunCommitContention commits b.N read-modify-write transactions from the
+// given number of concurrent writers. Every transaction increments a counter
+// stored in a randomly chosen key out of hotKeys keys. Transactions that fail
+// with a conflict (see ErrorClassifier) are retried immediately and counted as
+// aborts; any other error fails the benchmark.
+//
+// The committed transaction throughput is reported as txns/s, the number of
+// aborted transactions per committed transaction as aborts/op and the fraction
+// of all attempted transactions that aborted as abort-rate. The sum of all
+// counters is verified against b.N afterwards.
+func RunCommitContention(ctx context.Context, b *testing.B, db kv.Database, writers, hotKeys int) {
+	const prefix = "/BenchmarkCommitContention/"
+
+	cleanupPrefix(ctx, b, db, prefix)
+	defer cleanupPrefix(ctx, b, db, prefix)
+
+	key := func(i int) string {
+		return fmt.Sprintf("%shot%04d", prefix, i)
+	}
+
+	b.StopTimer()
+	tx, err := db.NewTransaction(ctx)
+	if err != nil {
+		b.Fatalf("NewTransaction: %v", err)
+	}
+	for i := 0; i < hotKeys; i++ {
+		if err := tx.Set(ctx, key(i), strings.NewReader("0")); err != nil {
+			tx.Rollback(ctx)
+			b.Fatalf("Set: %v", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		b.Fatalf("Commit: %v", err)
+	}
+	b.StartTimer()
+	b.ResetTimer()
+
+	increment := func(ctx context.Context, tx kv.Transaction, key string) error {
+		r, err := tx.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		n, err := strconv.Atoi(string(data))
+		if err != nil {
+			return fmt.Errorf("invalid counter value %q in key %q: %w", data, key, err)
+		}
+		return tx.Set(ctx, key, strings.NewReader(strconv.Itoa(n+1)))
+	}
+
+	var remaining, aborts atomic.Int64
+	remaining.Store(int64(b.N))
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			rnd := rand.New(rand.NewPCG(uint64(w), uint64(hotKeys)))
+			for remaining.Add(-1) >= 0 {
+				k := key(rnd.IntN(hotKeys))
+				for {
+					err := runAttempt(ctx, db, func(ctx context.Context, tx kv.Transaction) error {
+						return increment(ctx, tx, k)
+					})
+					if err == nil {
+						break
+					}
+					if classify(ctx, err) != ClassConflict {
+						b.Errorf("Increment %q: %v", k, err)
+						return
+					}
+					aborts.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	b.StopTimer()
+
+	if b.Failed() {
+		return
+	}
+
+	committed, aborted := float64(b.N), float64(aborts.Load())
+	b.ReportMetric(committed/b.Elapsed().Seconds(), "txns/s")
+	b.ReportMetric(aborted/committed, "aborts/op")
+	b.ReportMetric(aborted/(committed+aborted), "abort-rate")
+
+	snap, err := db.NewSnapshot(ctx)
+	if err != nil {
+		b.Fatalf("NewSnapshot: %v", err)
+	}
+	defer snap.Discard(ctx)
+
+	total := 0
+	for i := 0; i < hotKeys; i++ {
+		r, err := snap.Get(ctx, key(i))
+		if err != nil {
+			b.Fatalf("Get %q: %v", key(i), err)
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			b.Fatalf("Get %q: %v", key(i), err)
+		}
+		n, err := strconv.Atoi(string(data))
+		if err != nil {
+			b.Fatalf("Invalid counter value %q in key %q", data, key(i))
+		}
+		total += n
+	}
+	if total != b.N {
+		b.Errorf("Sum of counters = %d; want %d committed increments (lost updates?)", total, b.N)
+	}
+}
@@ -0,0 +1,125 @@
+package kvtests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"strings"
+	"testing"
+
+	"github.com/visvasity/kv"
+	"github.com/visvasity/kv/kvutil"
+)
+
+// RangeScanKeys is the number of keys loaded by BenchmarkRangeScan. Only a
+// hundredth of the keys are loaded in short mode.
+var RangeScanKeys = 1_000_000
+
+// RangeScanLimits are the numbers of items after which the Limit
+// sub-benchmarks of BenchmarkRangeScan stop iterating.
+var RangeScanLimits = []int{10, 100, 1000}
+
+// BenchmarkRangeScan loads RangeScanKeys keys under a single prefix and
+// measures Ascend and Descend over the whole prefix, all in a single snapshot
+// created outside the timed section:
+//
+//   - FirstKey measures the time to receive the first item,
+//   - Full measures a complete scan and also reports keys/s, and
+//   - Limit=k measures scans that stop after k items.
+//
+// Backends that materialize the whole range before yielding the first item
+// show FirstKey and Limit times close to the Full time instead of the time for
+// reading a handful of keys.
+func BenchmarkRangeScan(ctx context.Context, b *testing.B, db kv.Database) {
+	const prefix = "/BenchmarkRangeScan/"
+
+	cleanupPrefix(ctx, b, db, prefix)
+	defer cleanupPrefix(ctx, b, db, prefix)
+
+	numKeys := RangeScanKeys
+	if testing.Short() {
+		numKeys = max(1, numKeys/100)
+	}
+	rangeScanLoad(ctx, b, db, prefix, numKeys)
+
+	snap, err := db.NewSnapshot(ctx)
+	if err != nil {
+		b.Fatalf("NewSnapshot: %v", err)
+	}
+	defer snap.Discard(ctx)
+
+	begin, end := kvutil.PrefixRange(prefix)
+	scans := []struct {
+		name string
+		seq  func(errp *error) iter.Seq2[string, io.Reader]
+	}{
+		{"Ascend", func(errp *error) iter.Seq2[string, io.Reader] { return snap.Ascend(ctx, begin, end, errp) }},
+		{"Descend", func(errp *error) iter.Seq2[string, io.Reader] { return snap.Descend(ctx, begin, end, errp) }},
+	}
+	for _, scan := range scans {
+		b.Run(scan.name+"/FirstKey", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				rangeScan(b, scan.seq, 1)
+			}
+		})
+		b.Run(scan.name+"/Full", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if n := rangeScan(b, scan.seq, -1); n != numKeys {
+					b.Fatalf("%s returned %d keys; want %d", scan.name, n, numKeys)
+				}
+			}
+			b.ReportMetric(float64(b.N)*float64(numKeys)/b.Elapsed().Seconds(), "keys/s")
+		})
+		for _, limit := range RangeScanLimits {
+			if limit > numKeys {
+				continue
+			}
+			b.Run(fmt.Sprintf("%s/Limit=%d", scan.name, limit), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					rangeScan(b, scan.seq, limit)
+				}
+			})
+		}
+	}
+}
+
+// rangeScanLoad loads numKeys keys with fixed-size values under the prefix.
+func rangeScanLoad(ctx context.Context, b *testing.B, db kv.Database, prefix string, numKeys int) {
+	const batchSize = 1000
+
+	value := strings.Repeat("v", 16)
+	for start := 0; start < numKeys; start += batchSize {
+		tx, err := db.NewTransaction(ctx)
+		if err != nil {
+			b.Fatalf("NewTransaction (load): %v", err)
+		}
+		for n := start; n < min(start+batchSize, numKeys); n++ {
+			if err := tx.Set(ctx, fmt.Sprintf("%skey%08d", prefix, n), strings.NewReader(value)); err != nil {
+				b.Fatalf("Set (load): %v", err)
+			}
+		}
+		if err := tx.Commit(ctx); err != nil {
+			b.Fatalf("Commit (load): %v", err)
+		}
+	}
+}
+
+// rangeScan reads up to limit items (or all items when limit is negative) of
+// the sequence, including their values, and returns the number of items read.
+func rangeScan(b *testing.B, seq func(errp *error) iter.Seq2[string, io.Reader], limit int) int {
+	var iterErr error
+	n := 0
+	for _, r := range seq(&iterErr) {
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			b.Fatalf("could not read value: %v", err)
+		}
+		if n++; n == limit {
+			break
+		}
+	}
+	if iterErr != nil {
+		b.Fatalf("iteration failed: %v", iterErr)
+	}
+	return n
+}
@@ -0,0 +1,439 @@
+package kvtests
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/visvasity/kv"
+	"github.com/visvasity/kv/kvutil"
+)
+
+// KeyDistribution selects how YCSB operations choose existing records.
+type KeyDistribution int
+
+const (
+	// Zipfian picks records with a zipfian distribution, so that some records
+	// are much more popular than others. This is the YCSB default.
+	Zipfian KeyDistribution = iota
+
+	// Uniform picks all records with the same probability.
+	Uniform
+
+	// Latest picks recently inserted records more often than older records.
+	Latest
+)
+
+func (d KeyDistribution) String() string {
+	switch d {
+	case Zipfian:
+		return "zipfian"
+	case Uniform:
+		return "uniform"
+	case Latest:
+		return "latest"
+	}
+	return fmt.Sprintf("KeyDistribution(%d)", int(d))
+}
+
+// YCSBConfig configures the YCSB benchmarks.
+type YCSBConfig struct {
+	// RecordCount is the number of records loaded before the benchmark.
+	RecordCount int
+
+	// ValueSize is the size of every value in bytes.
+	ValueSize int
+
+	// Distribution is the key distribution for workloads that don't require a
+	// specific one.
+	Distribution KeyDistribution
+
+	// MaxScanLength is the maximum number of records read by a scan.
+	MaxScanLength int
+
+	// LatencyReportDir, if non-empty, is the directory where the per-operation
+	// latency summary of every benchmark is written as JSON, in a file named
+	// after the benchmark.
+	LatencyReportDir string
+}
+
+// DefaultYCSBConfig is the configuration used by the BenchmarkYCSBWorkload*
+// functions. It can be changed before running the benchmarks. Latency reports
+// are written to the directory named by the KVTESTS_LATENCY_DIR environment
+// variable, if set.
+var DefaultYCSBConfig = YCSBConfig{
+	RecordCount:      10_000,
+	ValueSize:        100,
+	Distribution:     Zipfian,
+	MaxScanLength:    100,
+	LatencyReportDir: os.Getenv("KVTESTS_LATENCY_DIR"),
+}
+
+// YCSBWorkload describes the operation mix of a YCSB workload. Proportions
+// must add up to one.
+type YCSBWorkload struct {
+	Name string
+
+	Read            float64
+	Update          float64
+	Insert          float64
+	Scan            float64
+	ReadModifyWrite float64
+
+	// Distribution overrides the configured key distribution if non-nil.
+	Distribution *KeyDistribution
+}
+
+var latestDistribution = Latest
+
+// Core YCSB workloads.
+var (
+	// YCSBWorkloadA is an update heavy workload.
+	YCSBWorkloadA = YCSBWorkload{Name: "A", Read: 0.5, Update: 0.5}
+
+	// YCSBWorkloadB is a read mostly workload.
+	YCSBWorkloadB = YCSBWorkload{Name: "B", Read: 0.95, Update: 0.05}
+
+	// YCSBWorkloadC is a read only workload.
+	YCSBWorkloadC = YCSBWorkload{Name: "C", Read: 1}
+
+	// YCSBWorkloadD reads the latest inserted records.
+	YCSBWorkloadD = YCSBWorkload{Name: "D", Read: 0.95, Insert: 0.05, Distribution: &latestDistribution}
+
+	// YCSBWorkloadE scans short ranges.
+	YCSBWorkloadE = YCSBWorkload{Name: "E", Scan: 0.95, Insert: 0.05}
+
+	// YCSBWorkloadF reads and then updates records in the same transaction.
+	YCSBWorkloadF = YCSBWorkload{Name: "F", Read: 0.5, ReadModifyWrite: 0.5}
+)
+
+// BenchmarkYCSBWorkloadA runs YCSB workload A with DefaultYCSBConfig.
+func BenchmarkYCSBWorkloadA(ctx context.Context, b *testing.B, db kv.Database) {
+	RunYCSB(ctx, b, db, YCSBWorkloadA, DefaultYCSBConfig)
+}
+
+// BenchmarkYCSBWorkloadB runs YCSB workload B with DefaultYCSBConfig.
+func BenchmarkYCSBWorkloadB(ctx context.Context, b *testing.B, db kv.Database) {
+	RunYCSB(ctx, b, db, YCSBWorkloadB, DefaultYCSBConfig)
+}
+
+// BenchmarkYCSBWorkloadC runs YCSB workload C with DefaultYCSBConfig.
+func BenchmarkYCSBWorkloadC(ctx context.Context, b *testing.B, db kv.Database) {
+	RunYCSB(ctx, b, db, YCSBWorkloadC, DefaultYCSBConfig)
+}
+
+// BenchmarkYCSBWorkloadD runs YCSB workload D with DefaultYCSBConfig.
+func BenchmarkYCSBWorkloadD(ctx context.Context, b *testing.B, db kv.Database) {
+	RunYCSB(ctx, b, db, YCSBWorkloadD, DefaultYCSBConfig)
+}
+
+// BenchmarkYCSBWorkloadE runs YCSB workload E with DefaultYCSBConfig.
+func BenchmarkYCSBWorkloadE(ctx context.Context, b *testing.B, db kv.Database) {
+	RunYCSB(ctx, b, db, YCSBWorkloadE, DefaultYCSBConfig)
+}
+
+// BenchmarkYCSBWorkloadF runs YCSB workload F with DefaultYCSBConfig.
+func BenchmarkYCSBWorkloadF(ctx context.Context, b *testing.B, db kv.Database) {
+	RunYCSB(ctx, b, db, YCSBWorkloadF, DefaultYCSBConfig)
+}
+
+// RunYCSB loads cfg.RecordCount records into the database and then runs b.N
+// operations of the workload from parallel goroutines (see
+// testing.B.RunParallel). Every operation runs in its own transaction, or in
+// its own snapshot for reads and scans. Conflicting updates are retried with
+// RunInTransaction and the number of retries is reported as aborts/op.
+//
+// The throughput is reported as ops/s and the p50, p99 and p999 latencies of
+// every database operation are reported as custom metrics (see
+// LatencyRecorder.ReportMetrics).
+func RunYCSB(ctx context.Context, b *testing.B, db kv.Database, w YCSBWorkload, cfg YCSBConfig) {
+	const prefix = "/BenchmarkYCSB/"
+
+	cleanupPrefix(ctx, b, db, prefix)
+	defer cleanupPrefix(ctx, b, db, prefix)
+
+	dist := cfg.Distribution
+	if w.Distribution != nil {
+		dist = *w.Distribution
+	}
+
+	y := &ycsb{
+		prefix: prefix,
+		cfg:    cfg,
+		value:  strings.Repeat("v", cfg.ValueSize),
+		zipf:   newZipfian(uint64(cfg.RecordCount)),
+	}
+	y.next.Store(int64(cfg.RecordCount))
+	y.acked = int64(cfg.RecordCount)
+
+	b.StopTimer()
+	y.load(ctx, b, db)
+	b.StartTimer()
+	b.ResetTimer()
+
+	var latency LatencyRecorder
+	db = latency.Wrap(db)
+
+	var seed atomic.Uint64
+	var aborts atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		rnd := rand.New(rand.NewPCG(seed.Add(1), 0))
+		for pb.Next() {
+			p := rnd.Float64()
+			var err error
+			switch {
+			case p < w.Read:
+				err = y.read(ctx, db, y.choose(rnd, dist))
+			case p < w.Read+w.Update:
+				err = y.update(ctx, db, y.choose(rnd, dist), &aborts)
+			case p < w.Read+w.Update+w.Insert:
+				err = y.insert(ctx, db)
+			case p < w.Read+w.Update+w.Insert+w.Scan:
+				err = y.scan(ctx, db, y.choose(rnd, dist), 1+rnd.IntN(cfg.MaxScanLength))
+			default:
+				err = y.readModifyWrite(ctx, db, y.choose(rnd, dist), &aborts)
+			}
+			if err != nil {
+				b.Errorf("YCSB workload %s: %v", w.Name, err)
+				return
+			}
+		}
+	})
+
+	b.StopTimer()
+	b.ReportMetric(float64(aborts.Load())/float64(b.N), "aborts/op")
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "ops/s")
+	latency.ReportMetrics(b)
+	if cfg.LatencyReportDir != "" {
+		if err := writeLatencyReport(b, cfg.LatencyReportDir, &latency); err != nil {
+			b.Errorf("could not write latency report: %v", err)
+		}
+	}
+}
+
+// writeLatencyReport writes the latency summary of the benchmark to a JSON
+// file in the directory, named after the benchmark.
+func writeLatencyReport(b *testing.B, dir string, latency *LatencyRecorder) error {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, b.Name())
+	return latency.WriteJSON(filepath.Join(dir, name+".json"))
+}
+
+// ycsb holds the state shared by all goroutines of a YCSB benchmark.
+type ycsb struct {
+	prefix string
+	cfg    YCSBConfig
+	value  string
+	zipf   *zipfian
+
+	// next is the record number for the next insert.
+	next atomic.Int64
+
+	// acked is the number of records from zero that are known to be committed.
+	// Operations only choose from these records.
+	mu      sync.Mutex
+	acked   int64
+	pending map[int64]bool
+}
+
+// key returns the key for the record number. Record numbers are hashed, so
+// that inserts are spread over the key space as in YCSB.
+func (y *ycsb) key(n int64) string {
+	h := fnv.New64a()
+	fmt.Fprint(h, n)
+	return fmt.Sprintf("%suser%016x", y.prefix, h.Sum64())
+}
+
+func (y *ycsb) load(ctx context.Context, b *testing.B, db kv.Database) {
+	const batchSize = 1000
+
+	for start := 0; start < y.cfg.RecordCount; start += batchSize {
+		tx, err := db.NewTransaction(ctx)
+		if err != nil {
+			b.Fatalf("NewTransaction (load): %v", err)
+		}
+		for n := start; n < min(start+batchSize, y.cfg.RecordCount); n++ {
+			if err := tx.Set(ctx, y.key(int64(n)), strings.NewReader(y.value)); err != nil {
+				b.Fatalf("Set (load): %v", err)
+			}
+		}
+		if err := tx.Commit(ctx); err != nil {
+			b.Fatalf("Commit (load): %v", err)
+		}
+	}
+}
+
+// choose returns the number of an existing record.
+func (y *ycsb) choose(rnd *rand.Rand, dist KeyDistribution) int64 {
+	y.mu.Lock()
+	n := y.acked
+	y.mu.Unlock()
+
+	switch dist {
+	case Uniform:
+		return rnd.Int64N(n)
+	case Latest:
+		return max(0, n-1-int64(y.zipf.next(rnd)))
+	}
+	return int64(y.zipf.next(rnd)) % n
+}
+
+func (y *ycsb) read(ctx context.Context, db kv.Database, n int64) error {
+	snap, err := db.NewSnapshot(ctx)
+	if err != nil {
+		return err
+	}
+	defer snap.Discard(ctx)
+
+	r, err := snap.Get(ctx, y.key(n))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(io.Discard, r)
+	return err
+}
+
+func (y *ycsb) scan(ctx context.Context, db kv.Database, n int64, length int) error {
+	snap, err := db.NewSnapshot(ctx)
+	if err != nil {
+		return err
+	}
+	defer snap.Discard(ctx)
+
+	_, end := kvutil.PrefixRange(y.prefix)
+	var iterErr error
+	count := 0
+	for _, r := range snap.Ascend(ctx, y.key(n), end, &iterErr) {
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return err
+		}
+		if count++; count == length {
+			break
+		}
+	}
+	return iterErr
+}
+
+func (y *ycsb) update(ctx context.Context, db kv.Database, n int64, aborts *atomic.Int64) error {
+	return y.retry(ctx, db, aborts, func(ctx context.Context, tx kv.Transaction) error {
+		return tx.Set(ctx, y.key(n), strings.NewReader(y.value))
+	})
+}
+
+func (y *ycsb) insert(ctx context.Context, db kv.Database) error {
+	n := y.next.Add(1) - 1
+	tx, err := db.NewTransaction(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := tx.Set(ctx, y.key(n), strings.NewReader(y.value)); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	y.ack(n)
+	return nil
+}
+
+// ack marks the record as committed and advances the acknowledged count over
+// all contiguous committed records.
+func (y *ycsb) ack(n int64) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+
+	if y.pending == nil {
+		y.pending = make(map[int64]bool)
+	}
+	y.pending[n] = true
+	for y.pending[y.acked] {
+		delete(y.pending, y.acked)
+		y.acked++
+	}
+}
+
+func (y *ycsb) readModifyWrite(ctx context.Context, db kv.Database, n int64, aborts *atomic.Int64) error {
+	return y.retry(ctx, db, aborts, func(ctx context.Context, tx kv.Transaction) error {
+		r, err := tx.Get(ctx, y.key(n))
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return err
+		}
+		return tx.Set(ctx, y.key(n), strings.NewReader(y.value))
+	})
+}
+
+// retry runs fn with RunInTransaction and counts the aborted attempts.
+func (y *ycsb) retry(ctx context.Context, db kv.Database, aborts *atomic.Int64, fn func(context.Context, kv.Transaction) error) error {
+	attempts := 0
+	err := RunInTransaction(ctx, db, func(ctx context.Context, tx kv.Transaction) error {
+		attempts++
+		return fn(ctx, tx)
+	}, &RetryOptions{MaxAttempts: 100})
+	aborts.Add(int64(attempts - 1))
+	return err
+}
+
+// zipfian generates numbers in [0, items) with a zipfian distribution, where
+// smaller numbers are more popular, using the algorithm from "Quickly
+// Generating Billion-Record Synthetic Databases" by Gray et al., as in YCSB.
+type zipfian struct {
+	items uint64
+	theta float64
+	alpha float64
+	zetan float64
+	eta   float64
+}
+
+// zipfianConstant is the YCSB default skew.
+const zipfianConstant = 0.99
+
+func newZipfian(items uint64) *zipfian {
+	theta := zipfianConstant
+	zeta2 := zeta(2, theta)
+	zetan := zeta(items, theta)
+	return &zipfian{
+		items: items,
+		theta: theta,
+		alpha: 1 / (1 - theta),
+		zetan: zetan,
+		eta:   (1 - math.Pow(2/float64(items), 1-theta)) / (1 - zeta2/zetan),
+	}
+}
+
+func zeta(n uint64, theta float64) float64 {
+	var sum float64
+	for i := uint64(1); i <= n; i++ {
+		sum += 1 / math.Pow(float64(i), theta)
+	}
+	return sum
+}
+
+func (z *zipfian) next(rnd *rand.Rand) uint64 {
+	u := rnd.Float64()
+	uz := u * z.zetan
+	if uz < 1 {
+		return 0
+	}
+	if uz < 1+math.Pow(0.5, z.theta) {
+		return 1
+	}
+	return min(z.items-1, uint64(float64(z.items)*math.Pow(z.eta*u-z.eta+1, z.alpha)))
+}
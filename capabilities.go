@@ -0,0 +1,60 @@
+package kvtests
+
+import (
+	"context"
+
+	"github.com/visvasity/kv"
+)
+
+// Capabilities describes implementation-defined behavior of a database that
+// tests adjust their expectations to. The zero value describes a database with
+// snapshot isolation.
+type Capabilities struct {
+	// Serializable is true if the database provides serializable isolation
+	// instead of snapshot isolation. Serializable databases may abort
+	// transactions, including read-only ones, that snapshot isolation commits.
+	Serializable bool `json:"serializable"`
+
+	// BlindWritesConflict is true if two concurrent transactions that write the
+	// same key without reading it (blind writes) conflict, so that the second
+	// committer fails. When false, both transactions commit and the write from
+	// the last committer wins. For example, kvmemdb ignores blind writes in its
+	// conflict detection.
+	BlindWritesConflict bool `json:"blind_writes_conflict"`
+
+	// BlockingConflicts is true if an operation that conflicts with another
+	// active transaction, such as a write of a key the other transaction wrote,
+	// can block until that transaction finishes, as with row locks. Tests that
+	// run fixed interleavings of transactions then consider an operation that
+	// doesn't complete in time as blocked and continue with the other
+	// transactions. When false, every operation is waited for, so that the
+	// interleavings are exact.
+	BlockingConflicts bool `json:"blocking_conflicts"`
+}
+
+// CapabilityReporter is an optional interface for kv.Database implementations
+// to declare their capabilities.
+type CapabilityReporter interface {
+	Capabilities() Capabilities
+}
+
+type capabilitiesKey struct{}
+
+// ContextWithCapabilities returns a context that declares the capabilities of
+// the database under test, for databases that don't implement the
+// CapabilityReporter interface.
+func ContextWithCapabilities(ctx context.Context, caps Capabilities) context.Context {
+	return context.WithValue(ctx, capabilitiesKey{}, caps)
+}
+
+// capabilitiesOf returns the capabilities declared by the database itself, or
+// else by the context, or else the zero value.
+func capabilitiesOf(ctx context.Context, db kv.Database) Capabilities {
+	if r, ok := databaseAs[CapabilityReporter](db); ok {
+		return r.Capabilities()
+	}
+	if caps, ok := ctx.Value(capabilitiesKey{}).(Capabilities); ok {
+		return caps
+	}
+	return Capabilities{}
+}
@@ -0,0 +1,15 @@
+// Command kvconform runs the kvtests conformance suite against the kv.Database
+// backends linked into the binary and prints a pass/fail/skip table.
+//
+// Backends from other repositories can be tested by building a copy of this
+// command that also imports their conform registration packages.
+package main
+
+import (
+	"github.com/visvasity/kvtests/conform"
+	_ "github.com/visvasity/kvtests/conform/memdb"
+)
+
+func main() {
+	conform.Main()
+}
@@ -0,0 +1,109 @@
+// Package conform runs the kvtests conformance suite against registered
+// kv.Database backends outside of go test.
+//
+// Backends register themselves, usually from an init function, with Register.
+// A conformance binary links the backends by importing their registration
+// packages for side effects and calls Main:
+//
+//	package main
+//
+//	import (
+//		"github.com/visvasity/kvtests/conform"
+//		_ "github.com/visvasity/kvtests/conform/memdb"
+//		_ "example.com/mybackend/kvconformplugin"
+//	)
+//
+//	func main() { conform.Main() }
+package conform
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/visvasity/kv"
+	"github.com/visvasity/kvtests"
+)
+
+// Backend is a kv.Database implementation that can be tested by Main.
+type Backend struct {
+	// Name identifies the backend on the command line and in the results. It
+	// must be unique and must not contain whitespace.
+	Name string
+
+	// Version is the version of the backend implementation, if known, for
+	// reports. See ModuleVersion.
+	Version string
+
+	// Open returns the database to test. Test cases run in separate processes
+	// and Open is called once in every process, so it may return a new empty
+	// database or connect to a shared one. If the database implements
+	// io.Closer, it is closed when the process is done with it.
+	Open func(ctx context.Context) (kv.Database, error)
+
+	// Capabilities, if non-nil, declares the capabilities of backends that
+	// don't implement kvtests.CapabilityReporter.
+	Capabilities *kvtests.Capabilities
+
+	// Classify, if non-nil, declares the error classes of backends whose
+	// errors don't match the sentinel errors of kvtests.Classify.
+	Classify kvtests.ErrorClassifier
+
+	// Expectations are the known deviations of the backend. They can be
+	// overridden from the command line with the -expect flag.
+	Expectations kvtests.Expectations
+}
+
+var (
+	mu       sync.Mutex
+	backends = make(map[string]Backend)
+)
+
+// Register makes a backend available to Main. It panics if the name is
+// invalid, if Open is nil or if a backend with the same name is already
+// registered.
+func Register(b Backend) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if b.Name == "" || strings.ContainsFunc(b.Name, isSpace) {
+		panic(fmt.Sprintf("conform: invalid backend name %q", b.Name))
+	}
+	if b.Open == nil {
+		panic(fmt.Sprintf("conform: backend %q has a nil Open function", b.Name))
+	}
+	if err := b.Expectations.Validate(); err != nil {
+		panic(fmt.Sprintf("conform: backend %q: %v", b.Name, err))
+	}
+	if _, ok := backends[b.Name]; ok {
+		panic(fmt.Sprintf("conform: backend %q is registered twice", b.Name))
+	}
+	backends[b.Name] = b
+}
+
+// Backends returns all registered backends sorted by name.
+func Backends() []Backend {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var list []Backend
+	for _, b := range backends {
+		list = append(list, b)
+	}
+	slices.SortFunc(list, func(a, b Backend) int { return strings.Compare(a.Name, b.Name) })
+	return list
+}
+
+func lookup(name string) (Backend, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	b, ok := backends[name]
+	return b, ok
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r'
+}
@@ -0,0 +1,284 @@
+package conform
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"testing"
+	"text/tabwriter"
+	"time"
+
+	"github.com/visvasity/kvtests"
+)
+
+// Main is the entry point of a conformance binary. It parses the command line,
+// runs the selected cases against the selected backends, prints a table of
+// results and exits with a non-zero status if any case failed.
+//
+// Main must be called at the start of the main function, because the binary
+// re-executes itself to run every case in a separate process.
+func Main() {
+	testing.Init()
+
+	var (
+		backendFlag = flag.String("backend", "", "comma-separated `names` of the backends to test (default all)")
+		runFlag     = flag.String("run", "", "run only the cases matching the regular `expression`")
+		listFlag    = flag.Bool("list", false, "list the backends and cases and exit")
+		verbose     = flag.Bool("v", false, "print the output of every case as it runs")
+		short       = flag.Bool("short", false, "run smaller versions of long-running cases")
+		timeout     = flag.Duration("timeout", 10*time.Minute, "fail a case if it runs longer than `duration`")
+		jsonFlag    = flag.String("json", "", "write a JSON report to `file`")
+		junitFlag   = flag.String("junit", "", "write a JUnit XML report to `file`")
+		seedFlag    = flag.String("seed", "", "random `seed` for all cases (default from $"+kvtests.SeedEnv+" or random)")
+		leakCheck   = flag.Bool("leakcheck", false, "fail cases that leave goroutines or open file descriptors behind")
+		replayFlag  = flag.String("replay", "", "re-run the `case` with the given name verbosely; use with -seed to replay a failure")
+		expectFlags []string
+		delays      = make(kvtests.Delays)
+	)
+	flag.Func("expect", "load expectations of `[backend=]file` in addition to the registered ones; applies to all backends if no backend is named (repeatable)", func(v string) error {
+		expectFlags = append(expectFlags, v)
+		return nil
+	})
+	flag.Func("delay", "inject latencies of `op=dist` into every case, where dist is fixed:D, uniform:MIN-MAX or exp:MEAN and op is an operation such as Commit or ReadValue (repeatable)", func(v string) error {
+		d, err := kvtests.ParseDelays(v)
+		maps.Copy(delays, d)
+		return err
+	})
+	flag.Usage = usage
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if isChild() {
+		code := runChild(ctx)
+		stop()
+		os.Exit(code)
+	}
+
+	backends, err := selectBackends(*backendFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "kvconform: %v\n", err)
+		os.Exit(2)
+	}
+	opts := Options{Verbose: *verbose, Short: *short, Timeout: *timeout, Delays: delays, LeakCheck: *leakCheck}
+	if opts.Seed, err = selectSeed(*seedFlag); err != nil {
+		fmt.Fprintf(os.Stderr, "kvconform: %v\n", err)
+		os.Exit(2)
+	}
+	if *replayFlag != "" {
+		if *runFlag != "" {
+			fmt.Fprintln(os.Stderr, "kvconform: -replay and -run can't be used together")
+			os.Exit(2)
+		}
+		*runFlag = "^" + regexp.QuoteMeta(*replayFlag) + "$"
+		opts.Verbose = true
+	}
+	if *runFlag != "" {
+		re, err := regexp.Compile(*runFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "kvconform: invalid -run expression: %v\n", err)
+			os.Exit(2)
+		}
+		opts.Run = re
+	}
+
+	if *listFlag {
+		list(os.Stdout, backends, opts.Run)
+		return
+	}
+
+	expectations, err := loadExpectations(backends, expectFlags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "kvconform: %v\n", err)
+		os.Exit(2)
+	}
+
+	report := &Report{Time: time.Now(), Seed: opts.Seed, Delays: delays.String(), LeakCheck: opts.LeakCheck}
+	var runErr error
+	for _, b := range backends {
+		opts.Expectations = expectations[b.Name]
+		br, err := RunBackend(ctx, b, opts)
+		report.Backends = append(report.Backends, br)
+		if err != nil {
+			runErr = fmt.Errorf("%s: %w", b.Name, err)
+			break
+		}
+	}
+
+	printResults(os.Stdout, report, !opts.Verbose)
+	code := 0
+	if *jsonFlag != "" {
+		if err := writeFile(*jsonFlag, report.WriteJSON); err != nil {
+			fmt.Fprintf(os.Stderr, "kvconform: could not write JSON report: %v\n", err)
+			code = 1
+		}
+	}
+	if *junitFlag != "" {
+		if err := writeFile(*junitFlag, report.WriteJUnit); err != nil {
+			fmt.Fprintf(os.Stderr, "kvconform: could not write JUnit report: %v\n", err)
+			code = 1
+		}
+	}
+	if runErr != nil {
+		fmt.Fprintf(os.Stderr, "kvconform: %v\n", runErr)
+		code = 1
+	}
+	for _, b := range report.Backends {
+		if !b.OK() {
+			code = 1
+		}
+	}
+	stop()
+	os.Exit(code)
+}
+
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "Usage: %s [flags]\n\nRuns the kvtests conformance suite against registered kv.Database backends.\n\nFlags:\n", os.Args[0])
+	flag.VisitAll(func(f *flag.Flag) {
+		if strings.HasPrefix(f.Name, "test.") {
+			return
+		}
+		name, usage := flag.UnquoteUsage(f)
+		if name != "" {
+			name = " " + name
+		}
+		fmt.Fprintf(w, "  -%s%s\n    \t%s", f.Name, name, usage)
+		if f.DefValue != "" && f.DefValue != "false" {
+			fmt.Fprintf(w, " (default %s)", f.DefValue)
+		}
+		fmt.Fprintln(w)
+	})
+}
+
+// selectBackends returns the registered backends named in the comma-separated
+// list, or all registered backends if the list is empty.
+func selectBackends(names string) ([]Backend, error) {
+	if names == "" {
+		all := Backends()
+		if len(all) == 0 {
+			return nil, fmt.Errorf("no backends are registered")
+		}
+		return all, nil
+	}
+	var selected []Backend
+	for _, name := range strings.Split(names, ",") {
+		b, ok := lookup(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unknown backend %q", name)
+		}
+		selected = append(selected, b)
+	}
+	return selected, nil
+}
+
+// selectSeed returns the seed from the -seed flag value, or else from the
+// environment, or else a random seed.
+func selectSeed(flagValue string) (uint64, error) {
+	if flagValue == "" {
+		flagValue = os.Getenv(kvtests.SeedEnv)
+	}
+	if flagValue == "" {
+		return rand.Uint64(), nil
+	}
+	return kvtests.ParseSeed(flagValue)
+}
+
+// loadExpectations returns the expectations of every backend: the registered
+// expectations overridden by the -expect flag values in order.
+func loadExpectations(backends []Backend, flags []string) (map[string]kvtests.Expectations, error) {
+	all := make(map[string]kvtests.Expectations)
+	for _, b := range backends {
+		all[b.Name] = maps.Clone(b.Expectations)
+		if all[b.Name] == nil {
+			all[b.Name] = make(kvtests.Expectations)
+		}
+	}
+	for _, v := range flags {
+		name, path, ok := strings.Cut(v, "=")
+		if !ok {
+			name, path = "", v
+		} else if _, found := lookup(name); !found {
+			return nil, fmt.Errorf("-expect names unknown backend %q", name)
+		}
+		exp, err := kvtests.LoadExpectations(path)
+		if err != nil {
+			return nil, err
+		}
+		for backend := range all {
+			if name == "" || name == backend {
+				maps.Copy(all[backend], exp)
+			}
+		}
+	}
+	return all, nil
+}
+
+// list prints the backends and the selected cases.
+func list(w io.Writer, backends []Backend, run *regexp.Regexp) {
+	fmt.Fprintln(w, "Backends:")
+	for _, b := range backends {
+		fmt.Fprintf(w, "  %s\n", b.Name)
+	}
+	fmt.Fprintln(w, "Cases:")
+	for _, c := range kvtests.Cases() {
+		if run == nil || run.MatchString(c.Name) {
+			fmt.Fprintf(w, "  %s\n", c.Name)
+		}
+	}
+}
+
+// printResults prints a table of the results followed by the output of every
+// failed case, if withOutput is true, and a summary line per backend.
+func printResults(w io.Writer, report *Report, withOutput bool) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "BACKEND\tCASE\tDURATION\tSTATUS")
+	for _, b := range report.Backends {
+		for _, r := range b.Results {
+			status := strings.ToUpper(string(r.Status))
+			if r.Reason != "" {
+				status += " (" + r.Reason + ")"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%v\t%s\n", r.Backend, r.Case, r.Duration.Round(10*time.Microsecond), status)
+		}
+	}
+	tw.Flush()
+
+	if withOutput {
+		for _, b := range report.Backends {
+			for _, r := range b.Results {
+				if r.Status == Fail && r.Output != "" {
+					fmt.Fprintf(w, "\n=== %s %s\n%s", r.Backend, r.Case, indent(r.Output, "    "))
+				}
+			}
+		}
+	}
+
+	extraFlags := ""
+	if report.Delays != "" {
+		extraFlags = " -delay " + report.Delays
+	}
+	if report.LeakCheck {
+		extraFlags += " -leakcheck"
+	}
+	fmt.Fprintln(w)
+	for _, b := range report.Backends {
+		for _, r := range b.Results {
+			if r.Status == Fail {
+				fmt.Fprintf(w, "replay %s with: -backend %s -replay %s -seed %d%s\n", r.Case, b.Name, r.Case, report.Seed, extraFlags)
+			}
+		}
+	}
+	fmt.Fprintf(w, "seed: %d\n", report.Seed)
+	for _, b := range report.Backends {
+		fmt.Fprintf(w, "%s: %d passed, %d failed, %d skipped, %d expected failures, %d unexpected passes\n", b.Name, b.Passed, b.Failed, b.Skipped, b.XFailed, b.XPassed)
+	}
+}
@@ -0,0 +1,69 @@
+// Package memdb registers the in-memory kvmemdb database as the "kvmemdb"
+// backend of the conform package, along with its known deviations from the
+// suite. It also registers kvmemdb served over a local kvhttp server as the
+// "kvhttp-kvmemdb" backend, which verifies that the semantics of kvmemdb
+// survive the remote boundary. Its client connects through a fault proxy, so
+// that the network fault cases run as well.
+package memdb
+
+import (
+	"context"
+	_ "embed"
+	"strings"
+
+	"github.com/visvasity/kv"
+	"github.com/visvasity/kvmemdb"
+	"github.com/visvasity/kvtests"
+	"github.com/visvasity/kvtests/conform"
+)
+
+//go:embed expectations.json
+var expectations []byte
+
+// capabilities are the capabilities of kvmemdb, which implements serializable
+// snapshot isolation and leaves blind writes out of its conflict detection, so
+// that the last of two concurrent blind writers wins. It detects conflicts at
+// commit and never blocks.
+var capabilities = kvtests.Capabilities{
+	Serializable:        true,
+	BlindWritesConflict: false,
+	BlockingConflicts:   false,
+}
+
+func init() {
+	exp, err := kvtests.ParseExpectations(expectations)
+	if err != nil {
+		panic(err)
+	}
+	conform.Register(conform.Backend{
+		Name:    "kvmemdb",
+		Version: conform.ModuleVersion("github.com/visvasity/kvmemdb"),
+		Open: func(ctx context.Context) (kv.Database, error) {
+			return kv.DatabaseFrom(kvmemdb.New()), nil
+		},
+		Capabilities: &capabilities,
+		Classify:     classify,
+		Expectations: exp,
+	})
+	conform.Register(conform.Backend{
+		Name:    "kvhttp-kvmemdb",
+		Version: conform.ModuleVersion("github.com/visvasity/kvmemdb"),
+		Open: func(ctx context.Context) (kv.Database, error) {
+			return openProxied(kv.DatabaseFrom(kvmemdb.New()))
+		},
+		Capabilities: &capabilities,
+		Classify:     classify,
+		Expectations: exp,
+	})
+}
+
+// classify maps the commit conflicts of kvmemdb, which are plain errors without
+// a sentinel, to kvtests.ClassConflict. Conflicts reported by a kvhttp server
+// keep their message, so they are matched the same way.
+func classify(err error) kvtests.ErrorClass {
+	msg := err.Error()
+	if strings.Contains(msg, "ssi: ") || strings.Contains(msg, "ww-conflict: ") {
+		return kvtests.ClassConflict
+	}
+	return kvtests.ClassFatal
+}
@@ -0,0 +1,52 @@
+package memdb
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/visvasity/kv"
+	"github.com/visvasity/kvtests"
+	"github.com/visvasity/kvtests/faultproxy"
+	"github.com/visvasity/kvtests/kvhttp"
+)
+
+// proxied is a kvhttp client for a loopback server that connects to the
+// server through a fault proxy, so that the network fault cases can run.
+type proxied struct {
+	*kvhttp.Client
+
+	transport *http.Transport
+	proxy     *faultproxy.Proxy
+	loopback  *kvhttp.Loopback
+}
+
+var _ kvtests.FaultProxied = (*proxied)(nil)
+
+func openProxied(db kv.Database) (*proxied, error) {
+	lb, err := kvhttp.NewLoopback(db)
+	if err != nil {
+		return nil, err
+	}
+	p, err := faultproxy.New(lb.Addr())
+	if err != nil {
+		lb.Close()
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 64
+	return &proxied{
+		Client:    kvhttp.NewClient("http://"+p.Addr(), &http.Client{Transport: transport}),
+		transport: transport,
+		proxy:     p,
+		loopback:  lb,
+	}, nil
+}
+
+func (p *proxied) FaultProxy() *faultproxy.Proxy {
+	return p.proxy
+}
+
+func (p *proxied) Close() error {
+	p.transport.CloseIdleConnections()
+	return errors.Join(p.proxy.Close(), p.loopback.Close())
+}
@@ -0,0 +1,297 @@
+package conform
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/visvasity/kvtests"
+)
+
+// Report is the machine-readable result of a conformance run.
+type Report struct {
+	Time time.Time `json:"time"`
+
+	// Seed is the random seed used by all cases. A case can be replayed with
+	// the same seed using the -replay and -seed flags.
+	Seed uint64 `json:"seed"`
+
+	// Delays are the latencies injected into all cases with the -delay flag,
+	// in the format of kvtests.ParseDelays.
+	Delays string `json:"delays,omitempty"`
+
+	// LeakCheck is true if cases were checked for leaked goroutines and file
+	// descriptors with the -leakcheck flag.
+	LeakCheck bool `json:"leak_check,omitempty"`
+
+	Backends []*BackendReport `json:"backends"`
+}
+
+// BackendReport holds the results of all cases run against a single backend.
+type BackendReport struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+
+	// Capabilities are the capabilities declared by the backend, either
+	// through kvtests.CapabilityReporter or Backend.Capabilities. They are
+	// unknown (nil) if no case could open the database.
+	Capabilities *kvtests.Capabilities `json:"capabilities,omitempty"`
+
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+	XFailed int `json:"xfailed"`
+	XPassed int `json:"xpassed"`
+
+	Results []Result `json:"results"`
+}
+
+// add appends the result and updates the counts.
+func (r *BackendReport) add(res Result) {
+	r.Results = append(r.Results, res)
+	switch res.Status {
+	case Pass:
+		r.Passed++
+	case Fail:
+		r.Failed++
+	case Skip:
+		r.Skipped++
+	case XFail:
+		r.XFailed++
+	case XPass:
+		r.XPassed++
+	}
+}
+
+// OK returns true if no case failed or passed unexpectedly.
+func (r *BackendReport) OK() bool {
+	return r.Failed == 0 && r.XPassed == 0
+}
+
+// Duration returns the total duration of all cases.
+func (r *BackendReport) Duration() time.Duration {
+	var d time.Duration
+	for _, res := range r.Results {
+		d += res.Duration
+	}
+	return d
+}
+
+// ModuleVersion returns the version of the module with the given path that is
+// linked into the current binary, or an empty string if it is unknown.
+// Backends can use it to fill in Backend.Version.
+func ModuleVersion(path string) string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	if info.Main.Path == path {
+		return info.Main.Version
+	}
+	for _, m := range info.Deps {
+		if m.Path == path {
+			if m.Replace != nil && m.Replace.Version != "" {
+				return m.Replace.Version
+			}
+			return m.Version
+		}
+	}
+	return ""
+}
+
+// messageRe matches the first line of a message logged through testing.T,
+// which is prefixed by the file name and line number of the caller.
+var messageRe = regexp.MustCompile(`^(\s*)\S+\.go:\d+: `)
+
+// messages extracts the messages logged by a case, including the panic message
+// if the case panicked, from its go test -v style output.
+func messages(output string) []string {
+	var msgs []string
+	indent := -1
+	for _, line := range strings.Split(output, "\n") {
+		if m := messageRe.FindStringSubmatch(line); m != nil {
+			indent = len(m[1])
+			msgs = append(msgs, strings.TrimSpace(line))
+			continue
+		}
+		if strings.HasPrefix(line, "panic: ") {
+			indent = -1
+			msgs = append(msgs, line)
+			continue
+		}
+		// Continuation lines of multi-line messages are indented further.
+		if indent >= 0 && len(line)-len(strings.TrimLeft(line, " \t")) > indent && len(msgs) > 0 {
+			msgs[len(msgs)-1] += "\n" + strings.TrimSpace(line)
+			continue
+		}
+		indent = -1
+	}
+	return msgs
+}
+
+// WriteJSON writes the report in JSON format.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// junitTestSuites and the following types define the commonly accepted subset
+// of the JUnit XML format.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// capabilityProperties returns a property for every capability, named after
+// its JSON field.
+func capabilityProperties(caps *kvtests.Capabilities) ([]junitProperty, error) {
+	data, err := json.Marshal(caps)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	var props []junitProperty
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		props = append(props, junitProperty{"capabilities." + k, fmt.Sprint(m[k])})
+	}
+	return props, nil
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// WriteJUnit writes the report in JUnit XML format, with a test suite per
+// backend. The backend version and capabilities are written as suite
+// properties. Since JUnit has no notion of expected failures, they are
+// reported as skipped and unexpected passes as failures.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	suites := junitTestSuites{Name: "kvconform"}
+	var total time.Duration
+	for _, b := range r.Backends {
+		suite := junitTestSuite{
+			Name:      b.Name,
+			Tests:     len(b.Results),
+			Failures:  b.Failed + b.XPassed,
+			Skipped:   b.Skipped + b.XFailed,
+			Time:      junitSeconds(b.Duration()),
+			Timestamp: r.Time.UTC().Format("2006-01-02T15:04:05"),
+		}
+		suite.Properties = append(suite.Properties, junitProperty{"seed", fmt.Sprint(r.Seed)})
+		if r.Delays != "" {
+			suite.Properties = append(suite.Properties, junitProperty{"delays", r.Delays})
+		}
+		if r.LeakCheck {
+			suite.Properties = append(suite.Properties, junitProperty{"leak_check", "true"})
+		}
+		if b.Version != "" {
+			suite.Properties = append(suite.Properties, junitProperty{"version", b.Version})
+		}
+		if b.Capabilities != nil {
+			props, err := capabilityProperties(b.Capabilities)
+			if err != nil {
+				return err
+			}
+			suite.Properties = append(suite.Properties, props...)
+		}
+		for _, res := range b.Results {
+			tc := junitTestCase{
+				Name:      res.Case,
+				Classname: b.Name,
+				Time:      junitSeconds(res.Duration),
+			}
+			msg := &junitMessage{Message: strings.Join(res.Messages, "\n"), Text: res.Output}
+			switch res.Status {
+			case Fail:
+				tc.Failure = msg
+			case Skip:
+				if res.Reason != "" {
+					msg.Message = "skipped by expectations: " + res.Reason
+				}
+				tc.Skipped = msg
+			case XFail:
+				msg.Message = "expected failure: " + res.Reason
+				tc.Skipped = msg
+			case XPass:
+				tc.Failure = &junitMessage{Message: "unexpected pass; expected failure: " + res.Reason}
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+		suites.Suites = append(suites.Suites, suite)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Skipped += suite.Skipped
+		total += b.Duration()
+	}
+	suites.Time = junitSeconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// writeFile writes the report to the file with the write function.
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
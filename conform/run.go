@@ -0,0 +1,348 @@
+package conform
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/visvasity/kvtests"
+)
+
+// Status is the outcome of a test case.
+type Status string
+
+const (
+	Pass Status = "pass"
+	Fail Status = "fail"
+	Skip Status = "skip"
+
+	// XFail is the status of a case that failed as expected (see
+	// kvtests.ExpectFail).
+	XFail Status = "xfail"
+
+	// XPass is the status of a case that was expected to fail, but passed.
+	// Unexpected passes fail the run, so that the expectation is removed.
+	XPass Status = "xpass"
+)
+
+// Result is the outcome of running a single test case against a backend.
+type Result struct {
+	Backend  string        `json:"-"`
+	Case     string        `json:"case"`
+	Status   Status        `json:"status"`
+	Duration time.Duration `json:"duration_ns"`
+
+	// Messages are the messages logged by failed and skipped cases, such as
+	// failure and skip reasons.
+	Messages []string `json:"messages,omitempty"`
+
+	// Output is the go test -v style output of failed and skipped cases.
+	Output string `json:"output,omitempty"`
+
+	// Reason is the reason for the deviation if the case has an expectation.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Options configures RunBackend.
+type Options struct {
+	// Run, if non-nil, selects the cases to run by name.
+	Run *regexp.Regexp
+
+	// Verbose streams the output of every case to os.Stdout as it runs, in
+	// the format of go test -v.
+	Verbose bool
+
+	// Short runs the cases in short mode (see testing.Short).
+	Short bool
+
+	// Timeout is the maximum duration of a single case. Zero means no limit.
+	Timeout time.Duration
+
+	// Expectations are the known deviations of the backend. Cases expected to
+	// be skipped are not run.
+	Expectations kvtests.Expectations
+
+	// Seed is the random seed of all cases (see kvtests.SeedEnv).
+	Seed uint64
+
+	// Delays, if non-empty, are injected into the operations of every case
+	// (see kvtests.DelayDatabase).
+	Delays kvtests.Delays
+
+	// LeakCheck fails every case that leaves goroutines or open file
+	// descriptors behind (see kvtests.LeakCheck).
+	LeakCheck bool
+}
+
+const (
+	childBackendEnv = "KVCONFORM_BACKEND"
+	childCaseEnv    = "KVCONFORM_CASE"
+	childResultEnv  = "KVCONFORM_RESULT"
+	childDelaysEnv  = "KVCONFORM_DELAYS"
+	childLeakEnv    = "KVCONFORM_LEAKCHECK"
+)
+
+// childResult is the result file written by the child process of a case.
+type childResult struct {
+	Status       Status                `json:"status"`
+	Duration     time.Duration         `json:"duration"`
+	Capabilities *kvtests.Capabilities `json:"capabilities,omitempty"`
+}
+
+// RunBackend runs the selected kvtests cases against the backend, in order,
+// and returns the report of their results. The report is returned along with
+// an error if the run was interrupted.
+//
+// Every case runs in a separate child process, which re-executes the current
+// binary, so that panics, crashes and hangs of one case can't affect others.
+// The binary must call Main before doing anything else, because Main acts as
+// the child process when it is invoked for a case.
+func RunBackend(ctx context.Context, b Backend, opts Options) (*BackendReport, error) {
+	report := &BackendReport{Name: b.Name, Version: b.Version}
+	exe, err := os.Executable()
+	if err != nil {
+		return report, fmt.Errorf("could not find the current executable: %w", err)
+	}
+
+	for _, c := range kvtests.Cases() {
+		if opts.Run != nil && !opts.Run.MatchString(c.Name) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		x, ok := opts.Expectations[c.Name]
+		if ok && x.Status == kvtests.ExpectSkip {
+			report.add(Result{Backend: b.Name, Case: c.Name, Status: Skip, Reason: x.Reason})
+			continue
+		}
+		res, caps := runCase(ctx, exe, b, c, opts)
+		if report.Capabilities == nil {
+			report.Capabilities = caps
+		}
+		if ok && x.Status == kvtests.ExpectFail {
+			res.Reason = x.Reason
+			switch res.Status {
+			case Fail:
+				res.Status = XFail
+			case Pass:
+				res.Status = XPass
+			}
+		}
+		report.add(res)
+	}
+	return report, nil
+}
+
+// runCase runs a single case in a child process and returns its result along
+// with the capabilities declared by the backend, if known.
+func runCase(ctx context.Context, exe string, b Backend, c kvtests.Case, opts Options) (Result, *kvtests.Capabilities) {
+	res := Result{Backend: b.Name, Case: c.Name, Status: Fail}
+
+	f, err := os.CreateTemp("", "kvconform-*.json")
+	if err != nil {
+		res.Output = fmt.Sprintf("kvconform: could not create result file: %v\n", err)
+		res.Messages = messages(res.Output)
+		return res, nil
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	args := []string{
+		"-test.count=1",
+		"-test.v=true",
+		fmt.Sprintf("-test.short=%t", opts.Short),
+		fmt.Sprintf("-test.timeout=%v", opts.Timeout),
+	}
+	if opts.Timeout > 0 {
+		// The child panics with all goroutine stacks when the test timeout
+		// expires; the context deadline is a last resort for stuck processes.
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout+time.Minute)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, exe, args...)
+	cmd.Env = append(os.Environ(),
+		childBackendEnv+"="+b.Name,
+		childCaseEnv+"="+c.Name,
+		childResultEnv+"="+f.Name(),
+		fmt.Sprintf("%s=%d", kvtests.SeedEnv, opts.Seed))
+	if len(opts.Delays) > 0 {
+		cmd.Env = append(cmd.Env, childDelaysEnv+"="+opts.Delays.String())
+	}
+	if opts.LeakCheck {
+		cmd.Env = append(cmd.Env, childLeakEnv+"=1")
+	}
+
+	var output bytes.Buffer
+	var w io.Writer = &output
+	if opts.Verbose {
+		w = io.MultiWriter(&output, os.Stdout)
+	}
+	cmd.Stdout, cmd.Stderr = w, w
+
+	start := time.Now()
+	runErr := cmd.Run()
+	res.Duration = time.Since(start)
+	res.Output = output.String()
+
+	var cr childResult
+	if data, err := os.ReadFile(f.Name()); err == nil && json.Unmarshal(data, &cr) == nil && cr.Status != "" {
+		res.Status, res.Duration = cr.Status, cr.Duration
+		if runErr != nil && res.Status != Fail {
+			res.Status = Fail
+			res.Output += fmt.Sprintf("kvconform: case process failed: %v\n", runErr)
+		}
+	} else {
+		if runErr == nil {
+			runErr = fmt.Errorf("no result was reported")
+		}
+		res.Output += fmt.Sprintf("kvconform: case process failed: %v\n", runErr)
+	}
+	if res.Status == Pass {
+		res.Output = ""
+	} else {
+		res.Messages = messages(res.Output)
+	}
+	return res, cr.Capabilities
+}
+
+// runChild runs the case named in the environment in the current process and
+// writes its result file. Returns the process exit code.
+func runChild(ctx context.Context) int {
+	b, ok := lookup(os.Getenv(childBackendEnv))
+	if !ok {
+		fmt.Fprintf(os.Stderr, "kvconform: unknown backend %q\n", os.Getenv(childBackendEnv))
+		return 2
+	}
+	name := os.Getenv(childCaseEnv)
+	var c kvtests.Case
+	for _, v := range kvtests.Cases() {
+		if v.Name == name {
+			c = v
+		}
+	}
+	if c.Func == nil {
+		fmt.Fprintf(os.Stderr, "kvconform: unknown case %q\n", name)
+		return 2
+	}
+
+	if b.Capabilities != nil {
+		ctx = kvtests.ContextWithCapabilities(ctx, *b.Capabilities)
+	}
+	if b.Classify != nil {
+		ctx = kvtests.ContextWithErrorClassifier(ctx, b.Classify)
+	}
+	db, err := b.Open(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "kvconform: could not open backend %q: %v\n", b.Name, err)
+		return 1
+	}
+	closer, _ := db.(io.Closer)
+
+	caps := kvtests.Capabilities{}
+	if r, ok := db.(kvtests.CapabilityReporter); ok {
+		caps = r.Capabilities()
+	} else if b.Capabilities != nil {
+		caps = *b.Capabilities
+	}
+	var delays kvtests.Delays
+	if v := os.Getenv(childDelaysEnv); v != "" {
+		if delays, err = kvtests.ParseDelays(v); err != nil {
+			fmt.Fprintf(os.Stderr, "kvconform: %v\n", err)
+			return 2
+		}
+	}
+	fn := c.Func
+	if os.Getenv(childLeakEnv) != "" {
+		fn = kvtests.LeakCheck(fn)
+	}
+	res := childResult{Capabilities: &caps}
+	tests := []testing.InternalTest{{
+		Name: c.Name,
+		F: func(t *testing.T) {
+			start := time.Now()
+			t.Cleanup(func() {
+				res.Duration = time.Since(start)
+				switch {
+				case t.Failed():
+					res.Status = Fail
+				case t.Skipped():
+					res.Status = Skip
+				default:
+					res.Status = Pass
+				}
+				if err := writeResult(os.Getenv(childResultEnv), &res); err != nil {
+					t.Errorf("kvconform: could not write result: %v", err)
+				}
+			})
+			if closer != nil {
+				t.Cleanup(func() { closer.Close() })
+			}
+			db := db
+			if len(delays) > 0 {
+				// The delays are sampled as in kvtests.Run, so that a seed
+				// replays the same latencies under go test.
+				db = kvtests.DelayCaseDatabase(ctx, t, db, delays, c.Name)
+			}
+			fn(ctx, t, db)
+		},
+	}}
+	// testing.Main exits the process, so the result is written by the test's
+	// cleanup function. The parent reports a failure if the process exits
+	// without a result or with a non-zero status.
+	testing.Main(matchString, tests, nil, nil)
+	return 0
+}
+
+// writeResult writes the case result to the result file.
+func writeResult(path string, res *childResult) error {
+	data, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+var (
+	matchMu   sync.Mutex
+	matchPat  string
+	matchExpr *regexp.Regexp
+)
+
+// matchString matches test names against the -test.run and -test.skip
+// patterns for testing.Main.
+func matchString(pat, str string) (bool, error) {
+	matchMu.Lock()
+	defer matchMu.Unlock()
+
+	if matchExpr == nil || matchPat != pat {
+		re, err := regexp.Compile(pat)
+		if err != nil {
+			return false, err
+		}
+		matchPat, matchExpr = pat, re
+	}
+	return matchExpr.MatchString(str), nil
+}
+
+// isChild returns true if the current process was started by RunBackend to
+// run a single case.
+func isChild() bool {
+	return os.Getenv(childCaseEnv) != ""
+}
+
+// indent indents every line of s by prefix.
+func indent(s, prefix string) string {
+	s = strings.TrimRight(s, "\n")
+	return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix) + "\n"
+}
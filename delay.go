@@ -0,0 +1,361 @@
+package kvtests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/visvasity/kv"
+)
+
+// Delay is a distribution of latencies injected by DelayDatabase.
+type Delay interface {
+	// Sample returns a random latency from the distribution.
+	Sample(rnd *rand.Rand) time.Duration
+	String() string
+}
+
+type fixedDelay time.Duration
+
+// FixedDelay returns a distribution that always returns d.
+func FixedDelay(d time.Duration) Delay {
+	return fixedDelay(d)
+}
+
+func (d fixedDelay) Sample(*rand.Rand) time.Duration { return time.Duration(d) }
+func (d fixedDelay) String() string                  { return "fixed:" + time.Duration(d).String() }
+
+type uniformDelay struct{ min, max time.Duration }
+
+// UniformDelay returns a distribution of latencies uniformly distributed in
+// [min, max).
+func UniformDelay(min, max time.Duration) Delay {
+	return uniformDelay{min, max}
+}
+
+func (d uniformDelay) Sample(rnd *rand.Rand) time.Duration {
+	if d.max <= d.min {
+		return d.min
+	}
+	return d.min + time.Duration(rnd.Int64N(int64(d.max-d.min)))
+}
+
+func (d uniformDelay) String() string { return fmt.Sprintf("uniform:%v-%v", d.min, d.max) }
+
+type exponentialDelay time.Duration
+
+// ExponentialDelay returns an exponential distribution of latencies with the
+// given mean, which has a long tail of slow operations.
+func ExponentialDelay(mean time.Duration) Delay {
+	return exponentialDelay(mean)
+}
+
+func (d exponentialDelay) Sample(rnd *rand.Rand) time.Duration {
+	return time.Duration(rnd.ExpFloat64() * float64(d))
+}
+
+func (d exponentialDelay) String() string { return "exp:" + time.Duration(d).String() }
+
+// ParseDelay parses a distribution in one of the formats "fixed:D",
+// "uniform:MIN-MAX" or "exp:MEAN", where D, MIN, MAX and MEAN are durations
+// such as "5ms".
+func ParseDelay(s string) (Delay, error) {
+	kind, arg, _ := strings.Cut(s, ":")
+	switch kind {
+	case "fixed", "exp":
+		d, err := time.ParseDuration(arg)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid delay %q: %w", s, os.ErrInvalid)
+		}
+		if kind == "fixed" {
+			return FixedDelay(d), nil
+		}
+		return ExponentialDelay(d), nil
+	case "uniform":
+		lo, hi, ok := strings.Cut(arg, "-")
+		min, err1 := time.ParseDuration(lo)
+		max, err2 := time.ParseDuration(hi)
+		if !ok || err1 != nil || err2 != nil || min < 0 || max < min {
+			return nil, fmt.Errorf("invalid delay %q: %w", s, os.ErrInvalid)
+		}
+		return UniformDelay(min, max), nil
+	}
+	return nil, fmt.Errorf("invalid delay %q (want fixed:D, uniform:MIN-MAX or exp:MEAN): %w", s, os.ErrInvalid)
+}
+
+// Delays maps operations to the distributions of their injected latencies.
+type Delays map[Op]Delay
+
+// ParseDelays parses delays in the format "Op=Delay,Op=Delay", such as
+// "Commit=exp:5ms,ReadValue=uniform:0s-1ms". See ParseOp and ParseDelay.
+func ParseDelays(s string) (Delays, error) {
+	delays := make(Delays)
+	for _, part := range strings.Split(s, ",") {
+		name, spec, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid delay %q (want Op=Delay): %w", part, os.ErrInvalid)
+		}
+		op, err := ParseOp(name)
+		if err != nil {
+			return nil, err
+		}
+		if delays[op], err = ParseDelay(spec); err != nil {
+			return nil, err
+		}
+	}
+	return delays, nil
+}
+
+func (d Delays) String() string {
+	var parts []string
+	for op := range numOps {
+		if delay, ok := d[op]; ok {
+			parts = append(parts, op.String()+"="+delay.String())
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// DelayDatabase returns a database wrapper that sleeps for a latency sampled
+// from the configured distribution before every operation, so that timing
+// sensitive bugs can be found by running the concurrent test cases under
+// adversarial timing (see WithDelays). The latencies are sampled from a random
+// number generator with the given seed.
+//
+// Operations that take a context return the context error if the context is
+// canceled while sleeping, except for Rollback and Discard, which always call
+// through to release the transaction or snapshot. The optional interfaces of
+// the database, such as Reopener and FaultProxied, are found by the test cases
+// through the Unwrap method of the wrapper.
+func DelayDatabase(db kv.Database, delays Delays, seed uint64) kv.Database {
+	return &delayDatabase{
+		db:      db,
+		delayer: &delayer{delays: delays, rnd: seededRand(seed, 0)},
+	}
+}
+
+// DelayCaseDatabase returns the DelayDatabase that the named test case is run
+// against by Run with WithDelays. Its latencies are sampled from a seed
+// derived from the run seed (see SeedEnv) and the case name, so that other
+// test runners replay the same latencies for the same run seed.
+func DelayCaseDatabase(ctx context.Context, t testing.TB, db kv.Database, delays Delays, name string) kv.Database {
+	t.Helper()
+
+	return DelayDatabase(db, delays, caseSeed(ctx, t, name+"/delays"))
+}
+
+// delayer samples and sleeps the delays of a DelayDatabase.
+type delayer struct {
+	delays Delays
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func (d *delayer) sample(op Op) time.Duration {
+	delay, ok := d.delays[op]
+	if !ok {
+		return 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return delay.Sample(d.rnd)
+}
+
+type delayObserverKey struct{}
+
+// withDelayObserver returns a context that makes DelayDatabase report every
+// injected delay of an operation with the context to the observer before
+// sleeping, so that a delayed operation isn't mistaken for a blocked one.
+func withDelayObserver(ctx context.Context, observe func(time.Duration)) context.Context {
+	return context.WithValue(ctx, delayObserverKey{}, observe)
+}
+
+// delayObserver returns the observer of injected delays of the context, or a
+// function that does nothing.
+func delayObserver(ctx context.Context) func(time.Duration) {
+	if observe, ok := ctx.Value(delayObserverKey{}).(func(time.Duration)); ok {
+		return observe
+	}
+	return func(time.Duration) {}
+}
+
+// sleep sleeps for the delay of the operation or until the context is done.
+func (d *delayer) sleep(ctx context.Context, op Op) error {
+	if v := d.sample(op); v > 0 {
+		delayObserver(ctx)(v)
+		timer := time.NewTimer(v)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return nil
+}
+
+// reader wraps a value so that every Read sleeps for the OpReadValue delay.
+// The delays are reported to the observer of the context, if any.
+func (d *delayer) reader(ctx context.Context, r io.Reader) io.Reader {
+	if _, ok := d.delays[OpReadValue]; !ok {
+		return r
+	}
+	return &delayReader{r: r, d: d, observe: delayObserver(ctx)}
+}
+
+// seq sleeps for the delay of the operation before every item of the
+// iteration and wraps every value.
+func (d *delayer) seq(ctx context.Context, op Op, seq iter.Seq2[string, io.Reader], errp *error) iter.Seq2[string, io.Reader] {
+	return func(yield func(string, io.Reader) bool) {
+		if err := d.sleep(ctx, op); err != nil {
+			*errp = err
+			return
+		}
+		for key, value := range seq {
+			if !yield(key, d.reader(ctx, value)) {
+				return
+			}
+			if err := d.sleep(ctx, op); err != nil {
+				*errp = err
+				return
+			}
+		}
+	}
+}
+
+type delayReader struct {
+	r       io.Reader
+	d       *delayer
+	observe func(time.Duration)
+}
+
+func (r *delayReader) Read(p []byte) (int, error) {
+	if v := r.d.sample(OpReadValue); v > 0 {
+		r.observe(v)
+		time.Sleep(v)
+	}
+	return r.r.Read(p)
+}
+
+type delayDatabase struct {
+	db kv.Database
+	*delayer
+}
+
+// Unwrap returns the wrapped database.
+func (d *delayDatabase) Unwrap() kv.Database {
+	return d.db
+}
+
+func (d *delayDatabase) NewTransaction(ctx context.Context) (kv.Transaction, error) {
+	if err := d.sleep(ctx, OpNewTransaction); err != nil {
+		return nil, err
+	}
+	tx, err := d.db.NewTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &delayTransaction{Transaction: tx, d: d.delayer}, nil
+}
+
+func (d *delayDatabase) NewSnapshot(ctx context.Context) (kv.Snapshot, error) {
+	if err := d.sleep(ctx, OpNewSnapshot); err != nil {
+		return nil, err
+	}
+	snap, err := d.db.NewSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &delaySnapshot{Snapshot: snap, d: d.delayer}, nil
+}
+
+type delayTransaction struct {
+	kv.Transaction
+
+	d *delayer
+}
+
+func (t *delayTransaction) Get(ctx context.Context, key string) (io.Reader, error) {
+	if err := t.d.sleep(ctx, OpGet); err != nil {
+		return nil, err
+	}
+	r, err := t.Transaction.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return t.d.reader(ctx, r), nil
+}
+
+func (t *delayTransaction) Set(ctx context.Context, key string, value io.Reader) error {
+	if err := t.d.sleep(ctx, OpSet); err != nil {
+		return err
+	}
+	return t.Transaction.Set(ctx, key, value)
+}
+
+func (t *delayTransaction) Delete(ctx context.Context, key string) error {
+	if err := t.d.sleep(ctx, OpDelete); err != nil {
+		return err
+	}
+	return t.Transaction.Delete(ctx, key)
+}
+
+func (t *delayTransaction) Ascend(ctx context.Context, beg, end string, errp *error) iter.Seq2[string, io.Reader] {
+	return t.d.seq(ctx, OpAscendItem, t.Transaction.Ascend(ctx, beg, end, errp), errp)
+}
+
+func (t *delayTransaction) Descend(ctx context.Context, beg, end string, errp *error) iter.Seq2[string, io.Reader] {
+	return t.d.seq(ctx, OpDescendItem, t.Transaction.Descend(ctx, beg, end, errp), errp)
+}
+
+func (t *delayTransaction) Commit(ctx context.Context) error {
+	if err := t.d.sleep(ctx, OpCommit); err != nil {
+		return err
+	}
+	return t.Transaction.Commit(ctx)
+}
+
+func (t *delayTransaction) Rollback(ctx context.Context) error {
+	ctx = context.WithoutCancel(ctx)
+	t.d.sleep(ctx, OpRollback)
+	return t.Transaction.Rollback(ctx)
+}
+
+type delaySnapshot struct {
+	kv.Snapshot
+
+	d *delayer
+}
+
+func (s *delaySnapshot) Get(ctx context.Context, key string) (io.Reader, error) {
+	if err := s.d.sleep(ctx, OpGet); err != nil {
+		return nil, err
+	}
+	r, err := s.Snapshot.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return s.d.reader(ctx, r), nil
+}
+
+func (s *delaySnapshot) Ascend(ctx context.Context, beg, end string, errp *error) iter.Seq2[string, io.Reader] {
+	return s.d.seq(ctx, OpAscendItem, s.Snapshot.Ascend(ctx, beg, end, errp), errp)
+}
+
+func (s *delaySnapshot) Descend(ctx context.Context, beg, end string, errp *error) iter.Seq2[string, io.Reader] {
+	return s.d.seq(ctx, OpDescendItem, s.Snapshot.Descend(ctx, beg, end, errp), errp)
+}
+
+func (s *delaySnapshot) Discard(ctx context.Context) error {
+	ctx = context.WithoutCancel(ctx)
+	s.d.sleep(ctx, OpDiscard)
+	return s.Snapshot.Discard(ctx)
+}
@@ -0,0 +1,280 @@
+package kvtests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/visvasity/kv"
+	"github.com/visvasity/kv/kvutil"
+)
+
+// DiffOpKind identifies the operation performed by a DiffOp.
+type DiffOpKind int
+
+const (
+	DiffGet DiffOpKind = iota
+	DiffSet
+	DiffDelete
+	DiffAscend
+	DiffDescend
+)
+
+func (k DiffOpKind) String() string {
+	switch k {
+	case DiffGet:
+		return "Get"
+	case DiffSet:
+		return "Set"
+	case DiffDelete:
+		return "Delete"
+	case DiffAscend:
+		return "Ascend"
+	case DiffDescend:
+		return "Descend"
+	}
+	return fmt.Sprintf("DiffOpKind(%d)", int(k))
+}
+
+// DiffOp is a single operation in a differential workload. Key is used by
+// Get, Set and Delete; Value only by Set; Begin and End only by Ascend and
+// Descend.
+type DiffOp struct {
+	Kind       DiffOpKind
+	Key        string
+	Value      string
+	Begin, End string
+}
+
+func (op DiffOp) String() string {
+	switch op.Kind {
+	case DiffSet:
+		return fmt.Sprintf("Set(%q, %d bytes)", op.Key, len(op.Value))
+	case DiffAscend, DiffDescend:
+		return fmt.Sprintf("%s(%q, %q)", op.Kind, op.Begin, op.End)
+	}
+	return fmt.Sprintf("%s(%q)", op.Kind, op.Key)
+}
+
+// DiffStep is one step of a differential workload. A step either runs its Ops
+// in a new transaction, which is then committed (or rolled back when Rollback
+// is true), or runs its Ops in a new snapshot, which is then discarded. Ops in
+// a snapshot step must be read-only.
+type DiffStep struct {
+	Snapshot bool
+	Rollback bool
+	Ops      []DiffOp
+}
+
+// DiffWorkload is a deterministic, single-threaded sequence of steps.
+type DiffWorkload []DiffStep
+
+// DiffRun applies the same workload to databases a and b and compares every
+// observable result: Get values, iteration order and values, and the class of
+// every returned error, as classified by the ErrorClassifier of the context.
+// The test fails at the first mismatch.
+//
+// Both databases are expected to start in the same state for all keys touched
+// by the workload.
+func DiffRun(ctx context.Context, t testing.TB, a, b kv.Database, workload DiffWorkload) {
+	t.Helper()
+
+	for i, step := range workload {
+		if step.Snapshot {
+			diffSnapshotStep(ctx, t, a, b, i, step)
+		} else {
+			diffTransactionStep(ctx, t, a, b, i, step)
+		}
+	}
+}
+
+func diffTransactionStep(ctx context.Context, t testing.TB, a, b kv.Database, i int, step DiffStep) {
+	t.Helper()
+
+	atx, err := a.NewTransaction(ctx)
+	if err != nil {
+		t.Fatalf("step %d: a.NewTransaction: %v", i, err)
+	}
+	defer atx.Rollback(ctx)
+
+	btx, err := b.NewTransaction(ctx)
+	if err != nil {
+		t.Fatalf("step %d: b.NewTransaction: %v", i, err)
+	}
+	defer btx.Rollback(ctx)
+
+	for j, op := range step.Ops {
+		ra := diffApply(ctx, atx, op)
+		rb := diffApply(ctx, btx, op)
+		if d := ra.diff(ctx, rb); d != "" {
+			t.Fatalf("step %d (transaction), op %d %v: %s", i, j, op, d)
+		}
+	}
+
+	var aerr, berr error
+	name := "Commit"
+	if step.Rollback {
+		name = "Rollback"
+		aerr, berr = atx.Rollback(ctx), btx.Rollback(ctx)
+	} else {
+		aerr, berr = atx.Commit(ctx), btx.Commit(ctx)
+	}
+	if ac, bc := classify(ctx, aerr), classify(ctx, berr); ac != bc {
+		t.Fatalf("step %d (transaction): %s error class mismatch: a=%s (%v), b=%s (%v)", i, name, ac, aerr, bc, berr)
+	}
+}
+
+func diffSnapshotStep(ctx context.Context, t testing.TB, a, b kv.Database, i int, step DiffStep) {
+	t.Helper()
+
+	asnap, err := a.NewSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("step %d: a.NewSnapshot: %v", i, err)
+	}
+	defer asnap.Discard(ctx)
+
+	bsnap, err := b.NewSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("step %d: b.NewSnapshot: %v", i, err)
+	}
+	defer bsnap.Discard(ctx)
+
+	for j, op := range step.Ops {
+		if op.Kind == DiffSet || op.Kind == DiffDelete {
+			t.Fatalf("step %d (snapshot), op %d %v: write operation in a snapshot step", i, j, op)
+		}
+		ra := diffApply(ctx, asnap, op)
+		rb := diffApply(ctx, bsnap, op)
+		if d := ra.diff(ctx, rb); d != "" {
+			t.Fatalf("step %d (snapshot), op %d %v: %s", i, j, op, d)
+		}
+	}
+}
+
+// diffResult holds the observable outcome of a single DiffOp.
+type diffResult struct {
+	err   error
+	value string
+	pairs [][2]string
+}
+
+func (r diffResult) diff(ctx context.Context, o diffResult) string {
+	if rc, oc := classify(ctx, r.err), classify(ctx, o.err); rc != oc {
+		return fmt.Sprintf("error class mismatch: a=%s (%v), b=%s (%v)", rc, r.err, oc, o.err)
+	}
+	if r.value != o.value {
+		return fmt.Sprintf("value mismatch: a=%q, b=%q", r.value, o.value)
+	}
+	for i := range min(len(r.pairs), len(o.pairs)) {
+		if r.pairs[i][0] != o.pairs[i][0] {
+			return fmt.Sprintf("item %d key mismatch: a=%q, b=%q", i, r.pairs[i][0], o.pairs[i][0])
+		}
+		if r.pairs[i][1] != o.pairs[i][1] {
+			return fmt.Sprintf("item %d (key %q) value mismatch: a=%q, b=%q", i, r.pairs[i][0], r.pairs[i][1], o.pairs[i][1])
+		}
+	}
+	if len(r.pairs) != len(o.pairs) {
+		return fmt.Sprintf("item count mismatch: a=%d, b=%d", len(r.pairs), len(o.pairs))
+	}
+	return ""
+}
+
+func diffApply(ctx context.Context, rw kv.Reader, op DiffOp) (res diffResult) {
+	switch op.Kind {
+	case DiffGet:
+		r, err := rw.Get(ctx, op.Key)
+		if err != nil {
+			res.err = err
+			return
+		}
+		data, err := io.ReadAll(r)
+		res.value, res.err = string(data), err
+	case DiffSet:
+		res.err = rw.(kv.Writer).Set(ctx, op.Key, strings.NewReader(op.Value))
+	case DiffDelete:
+		res.err = rw.(kv.Writer).Delete(ctx, op.Key)
+	case DiffAscend, DiffDescend:
+		var seq iter.Seq2[string, io.Reader]
+		if op.Kind == DiffAscend {
+			seq = rw.Ascend(ctx, op.Begin, op.End, &res.err)
+		} else {
+			seq = rw.Descend(ctx, op.Begin, op.End, &res.err)
+		}
+		for key, val := range seq {
+			data, err := io.ReadAll(val)
+			if err != nil {
+				res.err = err
+				return
+			}
+			res.pairs = append(res.pairs, [2]string{key, string(data)})
+		}
+	default:
+		res.err = fmt.Errorf("unknown diff op kind %v: %w", op.Kind, os.ErrInvalid)
+	}
+	return
+}
+
+// RandomDiffWorkload returns a deterministic pseudo-random workload of the
+// given number of steps for the given seed. All keys and ranges used by the
+// workload are confined to the prefix, which must be non-empty.
+func RandomDiffWorkload(seed uint64, prefix string, steps int) DiffWorkload {
+	rnd := rand.New(rand.NewPCG(seed, 0))
+
+	key := func() string {
+		return fmt.Sprintf("%sk%02d", prefix, rnd.IntN(32))
+	}
+	value := func() string {
+		data := make([]byte, rnd.IntN(64))
+		for i := range data {
+			data[i] = byte('a' + rnd.IntN(26))
+		}
+		return string(data)
+	}
+	first, last := kvutil.PrefixRange(prefix)
+	scan := func(kind DiffOpKind) DiffOp {
+		begin, end := key(), key()
+		if begin > end {
+			begin, end = end, begin
+		}
+		switch rnd.IntN(4) {
+		case 0:
+			begin = first
+		case 1:
+			end = last
+		}
+		return DiffOp{Kind: kind, Begin: begin, End: end}
+	}
+
+	workload := make(DiffWorkload, 0, steps)
+	for range steps {
+		step := DiffStep{
+			Snapshot: rnd.IntN(4) == 0,
+			Rollback: rnd.IntN(8) == 0,
+		}
+		for range 1 + rnd.IntN(8) {
+			var op DiffOp
+			switch n := rnd.IntN(10); {
+			case n < 3:
+				op = DiffOp{Kind: DiffGet, Key: key()}
+			case n < 4:
+				op = scan(DiffAscend)
+			case n < 5:
+				op = scan(DiffDescend)
+			case step.Snapshot:
+				op = DiffOp{Kind: DiffGet, Key: key()}
+			case n < 8:
+				op = DiffOp{Kind: DiffSet, Key: key(), Value: value()}
+			default:
+				op = DiffOp{Kind: DiffDelete, Key: key()}
+			}
+			step.Ops = append(step.Ops, op)
+		}
+		workload = append(workload, step)
+	}
+	return workload
+}
@@ -0,0 +1,114 @@
+package kvtests
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/visvasity/kv"
+	"github.com/visvasity/kv/kvutil"
+	"github.com/visvasity/kvmemdb"
+)
+
+// fatalRecorder is a testing.TB that records the message of the first Fatalf
+// call instead of failing the test.
+type fatalRecorder struct {
+	testing.TB
+	msg string
+}
+
+func (r *fatalRecorder) Helper() {}
+
+func (r *fatalRecorder) Fatalf(format string, args ...any) {
+	r.msg = fmt.Sprintf(format, args...)
+	runtime.Goexit()
+}
+
+// diffMessage runs the workload with DiffRun and returns the reported
+// mismatch, or the empty string if none was reported.
+func diffMessage(t *testing.T, a, b kv.Database, workload DiffWorkload) string {
+	r := &fatalRecorder{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		DiffRun(context.Background(), r, a, b, workload)
+	}()
+	<-done
+	return r.msg
+}
+
+// lostDeletes is a database whose transactions ignore Delete.
+type lostDeletes struct {
+	kv.Database
+}
+
+func (d lostDeletes) NewTransaction(ctx context.Context) (kv.Transaction, error) {
+	tx, err := d.Database.NewTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return lostDeletesTx{tx}, nil
+}
+
+type lostDeletesTx struct {
+	kv.Transaction
+}
+
+func (lostDeletesTx) Delete(ctx context.Context, key string) error {
+	return nil
+}
+
+func TestDiffRunEqual(t *testing.T) {
+	a := kv.DatabaseFrom(kvmemdb.New())
+	b := kv.DatabaseFrom(kvmemdb.New())
+	for seed := range uint64(10) {
+		workload := RandomDiffWorkload(seed, "/TestDiffRunEqual/", 200)
+		if msg := diffMessage(t, a, b, workload); msg != "" {
+			t.Fatalf("seed %d: DiffRun reported a mismatch of equal databases: %s", seed, msg)
+		}
+	}
+}
+
+func TestDiffRunMismatch(t *testing.T) {
+	workload := DiffWorkload{
+		{Ops: []DiffOp{{Kind: DiffSet, Key: "/a", Value: "1"}, {Kind: DiffSet, Key: "/b", Value: "2"}}},
+		{Ops: []DiffOp{{Kind: DiffDelete, Key: "/a"}}},
+		{Snapshot: true, Ops: []DiffOp{{Kind: DiffAscend, Begin: "/", End: "0"}}},
+	}
+	a := kv.DatabaseFrom(kvmemdb.New())
+	b := lostDeletes{kv.DatabaseFrom(kvmemdb.New())}
+
+	msg := diffMessage(t, a, b, workload)
+	if want := "step 2 (snapshot), op 0"; !strings.HasPrefix(msg, want) {
+		t.Fatalf("DiffRun reported %q; want a mismatch at %q", msg, want)
+	}
+	if want := "item 0 key mismatch"; !strings.Contains(msg, want) {
+		t.Errorf("DiffRun reported %q; want %q", msg, want)
+	}
+}
+
+func TestRandomDiffWorkloadDeterministic(t *testing.T) {
+	const prefix = "/TestRandomDiffWorkloadDeterministic/"
+	w1 := RandomDiffWorkload(42, prefix, 100)
+	w2 := RandomDiffWorkload(42, prefix, 100)
+	_, last := kvutil.PrefixRange(prefix)
+	if fmt.Sprint(w1) != fmt.Sprint(w2) {
+		t.Fatalf("RandomDiffWorkload returned different workloads for the same seed")
+	}
+	for i, step := range w1 {
+		for _, op := range step.Ops {
+			if step.Snapshot && (op.Kind == DiffSet || op.Kind == DiffDelete) {
+				t.Errorf("step %d: write operation %v in a snapshot step", i, op)
+			}
+			if op.Kind == DiffAscend || op.Kind == DiffDescend {
+				if !strings.HasPrefix(op.Begin, prefix) || op.End > last {
+					t.Errorf("step %d: range %v is not confined to the prefix", i, op)
+				}
+			} else if !strings.HasPrefix(op.Key, prefix) {
+				t.Errorf("step %d: key of %v is not confined to the prefix", i, op)
+			}
+		}
+	}
+}
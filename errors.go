@@ -0,0 +1,153 @@
+package kvtests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrConflict is the sentinel error for transactions that failed because of a
+// conflict with a concurrent transaction. Such transactions can be retried.
+//
+// Database implementations that can depend on this package may return errors
+// that match ErrConflict with errors.Is when Commit (or any other operation)
+// fails due to a conflict, for example, by wrapping it with fmt.Errorf and %w.
+// Other implementations declare how their errors are classified with an
+// ErrorClassifier instead.
+var ErrConflict = errors.New("transaction conflict")
+
+// ErrUnknownOutcome is the sentinel error for Commit calls of remote databases
+// that failed without learning whether the transaction was applied, for
+// example, because the connection was lost after the commit request was sent.
+//
+// A Commit that fails with any other error must not have applied the
+// transaction. Database clients that can't rule out that a failed commit was
+// applied must return an error that matches ErrUnknownOutcome with errors.Is,
+// or that their ErrorClassifier maps to ClassUnknownOutcome.
+var ErrUnknownOutcome = errors.New("transaction outcome is unknown")
+
+// ErrorClass is the category of an error returned by a kv.Database
+// implementation. The error class, and not the exact error, is what callers
+// can rely on across implementations.
+type ErrorClass int
+
+const (
+	// ClassNone is the class of the nil error.
+	ClassNone ErrorClass = iota
+
+	// ClassConflict is the class of errors matching ErrConflict. Operations
+	// failing with these errors can be retried in a new transaction.
+	ClassConflict
+
+	// ClassUnknownOutcome is the class of errors matching ErrUnknownOutcome.
+	// The transaction may or may not have been applied, so it must not be
+	// retried blindly.
+	ClassUnknownOutcome
+
+	// ClassClosed is the class of errors matching os.ErrClosed, returned when a
+	// committed or rolled back transaction or a discarded snapshot is used.
+	ClassClosed
+
+	// ClassInvalid is the class of errors matching os.ErrInvalid, returned for
+	// invalid arguments like empty keys, nil values and bad ranges.
+	ClassInvalid
+
+	// ClassNotExist is the class of errors matching os.ErrNotExist, returned
+	// for missing keys.
+	ClassNotExist
+
+	// ClassFatal is the class of all other errors, which should not be retried.
+	ClassFatal
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ClassNone:
+		return "none"
+	case ClassConflict:
+		return "conflict"
+	case ClassUnknownOutcome:
+		return "unknown-outcome"
+	case ClassClosed:
+		return "closed"
+	case ClassInvalid:
+		return "invalid"
+	case ClassNotExist:
+		return "not-exist"
+	case ClassFatal:
+		return "fatal"
+	}
+	return fmt.Sprintf("ErrorClass(%d)", int(c))
+}
+
+// Classify returns the class of the error. Conflicts take precedence over all
+// other classes.
+func Classify(err error) ErrorClass {
+	switch {
+	case err == nil:
+		return ClassNone
+	case errors.Is(err, ErrConflict):
+		return ClassConflict
+	case errors.Is(err, ErrUnknownOutcome):
+		return ClassUnknownOutcome
+	case errors.Is(err, os.ErrClosed):
+		return ClassClosed
+	case errors.Is(err, os.ErrInvalid):
+		return ClassInvalid
+	case errors.Is(err, os.ErrNotExist):
+		return ClassNotExist
+	}
+	return ClassFatal
+}
+
+// ErrorClassifier returns the class of an error returned by the database under
+// test. Classifiers declare the error classes of databases whose errors don't
+// match the sentinel errors used by Classify, so that implementations need not
+// depend on this package. A classifier returns ClassFatal for errors it
+// doesn't recognize, which are then classified by Classify.
+type ErrorClassifier func(err error) ErrorClass
+
+type errorClassifierKey struct{}
+
+// ContextWithErrorClassifier returns a context that declares how the errors of
+// the database under test are classified.
+func ContextWithErrorClassifier(ctx context.Context, classifier ErrorClassifier) context.Context {
+	return context.WithValue(ctx, errorClassifierKey{}, classifier)
+}
+
+// classify returns the class of the error using the classifier declared by the
+// context, falling back to Classify.
+func classify(ctx context.Context, err error) ErrorClass {
+	if err == nil {
+		return ClassNone
+	}
+	if c, ok := ctx.Value(errorClassifierKey{}).(ErrorClassifier); ok {
+		if class := c(err); class != ClassFatal && class != ClassNone {
+			return class
+		}
+	}
+	return Classify(err)
+}
+
+// IsConflict returns true if the error is a transaction conflict.
+func IsConflict(err error) bool {
+	return Classify(err) == ClassConflict
+}
+
+// IsClosed returns true if the error reports use of a closed transaction or
+// snapshot.
+func IsClosed(err error) bool {
+	return Classify(err) == ClassClosed
+}
+
+// IsInvalid returns true if the error reports an invalid argument.
+func IsInvalid(err error) bool {
+	return Classify(err) == ClassInvalid
+}
+
+// IsUnknownOutcome returns true if the error reports a failed Commit that may
+// or may not have applied the transaction.
+func IsUnknownOutcome(err error) bool {
+	return Classify(err) == ClassUnknownOutcome
+}
@@ -0,0 +1,93 @@
+package kvtests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// ExpectedStatus is the expected outcome of a test case that a database
+// legitimately deviates from.
+type ExpectedStatus string
+
+const (
+	// ExpectFail marks a case that is known to fail. Run skips such cases;
+	// kvconform runs them and reports them as XFAIL, or as XPASS if they pass
+	// unexpectedly.
+	ExpectFail ExpectedStatus = "xfail"
+
+	// ExpectSkip marks a case that must not be run at all, for example because
+	// it crashes or hangs the database.
+	ExpectSkip ExpectedStatus = "skip"
+)
+
+// Expectation is the expected outcome of a test case with the reason for the
+// deviation.
+type Expectation struct {
+	Status ExpectedStatus `json:"status"`
+	Reason string         `json:"reason"`
+}
+
+// Expectations maps test case names (see Cases) to their expected outcomes for
+// a particular database, so that a database can adopt the suite incrementally.
+// Cases that are not listed are expected to pass.
+//
+// Expectations are usually kept in a JSON file next to the database, such as:
+//
+//	{
+//	  "TestRangeBeginEndInvalid": {"status": "xfail", "reason": "ranges with begin > end are treated as empty"},
+//	  "TestManySnapshots": {"status": "skip", "reason": "snapshots hold a connection each"}
+//	}
+type Expectations map[string]Expectation
+
+// LoadExpectations reads expectations from a JSON file. See
+// ParseExpectations.
+func LoadExpectations(path string) (Expectations, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	exp, err := ParseExpectations(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return exp, nil
+}
+
+// ParseExpectations parses expectations in JSON format. It fails if an entry
+// names an unknown case, has an unknown status or has no reason.
+func ParseExpectations(data []byte) (Expectations, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var exp Expectations
+	if err := dec.Decode(&exp); err != nil {
+		return nil, fmt.Errorf("invalid expectations: %w", err)
+	}
+	if err := exp.Validate(); err != nil {
+		return nil, err
+	}
+	return exp, nil
+}
+
+// Validate checks that every entry names a known case, has a known status and
+// gives a reason.
+func (e Expectations) Validate() error {
+	known := make(map[string]bool)
+	for _, c := range Cases() {
+		known[c.Name] = true
+	}
+	for name, x := range e {
+		if !known[name] {
+			return fmt.Errorf("expectation for unknown test case %q: %w", name, os.ErrInvalid)
+		}
+		if x.Status != ExpectFail && x.Status != ExpectSkip {
+			return fmt.Errorf("expectation for %s has invalid status %q (want %q or %q): %w", name, x.Status, ExpectFail, ExpectSkip, os.ErrInvalid)
+		}
+		if x.Reason == "" {
+			return fmt.Errorf("expectation for %s has no reason: %w", name, os.ErrInvalid)
+		}
+	}
+	return nil
+}
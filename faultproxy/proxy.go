@@ -0,0 +1,305 @@
+// Package faultproxy implements a local TCP proxy that injects network faults
+// into the connections between a database client and its server, so that
+// tests can verify how a client behaves when a connection is dropped, stalled
+// or reset in the middle of an operation.
+//
+// A test connects the client to the proxy address instead of the server,
+// injects a fault right before the operation under test and clears it after:
+//
+//	p.Inject(faultproxy.Fault{Kind: faultproxy.Reset, Direction: faultproxy.ToClient})
+//	err := tx.Commit(ctx)
+//	p.Clear()
+package faultproxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// Kind is the kind of a fault.
+type Kind int
+
+const (
+	// Drop closes both sides of the connection, as if the peer closed it.
+	Drop Kind = iota
+
+	// Stall stops forwarding data on the connection in the direction of the
+	// fault until the fault is cleared, as if the network was partitioned.
+	Stall
+
+	// Reset aborts both sides of the connection with a TCP reset.
+	Reset
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Drop:
+		return "drop"
+	case Stall:
+		return "stall"
+	case Reset:
+		return "reset"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Direction is the direction of data on a connection.
+type Direction int
+
+const (
+	// ToServer is the direction of requests, from the client to the server.
+	ToServer Direction = iota
+
+	// ToClient is the direction of responses, from the server to the client.
+	ToClient
+)
+
+func (d Direction) String() string {
+	switch d {
+	case ToServer:
+		return "to-server"
+	case ToClient:
+		return "to-client"
+	}
+	return fmt.Sprintf("Direction(%d)", int(d))
+}
+
+// Fault describes a fault that hits the first connection which carries data
+// in its direction after it is injected.
+type Fault struct {
+	Kind      Kind
+	Direction Direction
+
+	// After is the number of bytes forwarded in the direction, over all
+	// connections, before the fault hits. Zero hits the next data, so that a
+	// ToServer fault loses the next request and a ToClient fault loses the
+	// next response.
+	After int
+}
+
+func (f Fault) String() string {
+	return fmt.Sprintf("%s %s after %d bytes", f.Kind, f.Direction, f.After)
+}
+
+// Proxy forwards TCP connections from a local address to a target address and
+// injects faults into them.
+type Proxy struct {
+	target string
+	l      net.Listener
+
+	mu        sync.Mutex
+	closed    bool
+	conns     map[*proxyConn]struct{}
+	fault     *Fault
+	forwarded int           // bytes forwarded in the fault direction since Inject
+	hit       chan struct{} // closed when the fault hits
+	release   chan struct{} // closed by Clear to resume stalled connections
+
+	wg sync.WaitGroup
+}
+
+// New returns a proxy that listens on a random local port and forwards
+// connections to the target address.
+func New(target string) (*Proxy, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	p := &Proxy{
+		target:  target,
+		l:       l,
+		conns:   make(map[*proxyConn]struct{}),
+		release: make(chan struct{}),
+	}
+	p.wg.Add(1)
+	go p.serve()
+	return p, nil
+}
+
+// Addr returns the local address of the proxy.
+func (p *Proxy) Addr() string {
+	return p.l.Addr().String()
+}
+
+// Close stops the proxy and closes all connections.
+func (p *Proxy) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	err := p.l.Close()
+	for c := range p.conns {
+		c.close(false)
+	}
+	p.clearLocked()
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	return err
+}
+
+// Inject arms the fault, replacing any fault that has not hit yet. The
+// returned channel is closed when the fault hits.
+func (p *Proxy) Inject(f Fault) <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.fault = &f
+	p.forwarded = 0
+	p.hit = make(chan struct{})
+	return p.hit
+}
+
+// Clear disarms the fault if it has not hit yet and resumes all stalled
+// connections.
+func (p *Proxy) Clear() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.clearLocked()
+}
+
+func (p *Proxy) clearLocked() {
+	p.fault = nil
+	close(p.release)
+	p.release = make(chan struct{})
+}
+
+func (p *Proxy) serve() {
+	defer p.wg.Done()
+
+	for {
+		client, err := p.l.Accept()
+		if err != nil {
+			return
+		}
+		server, err := net.Dial("tcp", p.target)
+		if err != nil {
+			client.Close()
+			continue
+		}
+		c := &proxyConn{p: p, client: client.(*net.TCPConn), server: server.(*net.TCPConn)}
+
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			c.close(false)
+			return
+		}
+		p.conns[c] = struct{}{}
+		p.mu.Unlock()
+
+		p.wg.Add(2)
+		go c.pipe(ToServer, c.server, c.client)
+		go c.pipe(ToClient, c.client, c.server)
+	}
+}
+
+// admit returns the number of bytes of the n read bytes in the direction that
+// can be forwarded before the fault hits, and the fault if it hits. Stalls
+// also return the channel that resumes the connection.
+func (p *Proxy) admit(dir Direction, n int) (int, *Fault, <-chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	f := p.fault
+	if f == nil || f.Direction != dir {
+		return n, nil, nil
+	}
+	left := max(f.After-p.forwarded, 0)
+	if left >= n {
+		p.forwarded += n
+		return n, nil, nil
+	}
+	p.fault = nil
+	close(p.hit)
+	return left, f, p.release
+}
+
+// proxyConn is a client connection and its connection to the target.
+type proxyConn struct {
+	p              *Proxy
+	client, server *net.TCPConn
+
+	once  sync.Once
+	pipes atomic.Int32 // number of finished pipes
+}
+
+// close closes both connections, with a TCP reset if reset is true.
+func (c *proxyConn) close(reset bool) {
+	c.once.Do(func() {
+		if reset {
+			c.client.SetLinger(0)
+			c.server.SetLinger(0)
+		}
+		c.client.Close()
+		c.server.Close()
+	})
+}
+
+// pipe forwards data from src to dst in the direction until either side is
+// closed or a fault hits.
+func (c *proxyConn) pipe(dir Direction, dst, src *net.TCPConn) {
+	defer c.p.wg.Done()
+	defer func() {
+		if c.pipes.Add(1) == 2 {
+			c.close(false)
+			c.p.mu.Lock()
+			delete(c.p.conns, c)
+			c.p.mu.Unlock()
+		}
+	}()
+
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			ok, werr := c.forward(dir, dst, buf[:n])
+			if !ok {
+				return
+			}
+			if werr != nil {
+				c.close(false)
+				return
+			}
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				// Forward the half close, so that the peer sees the end of the
+				// data before the connection is closed.
+				dst.CloseWrite()
+				return
+			}
+			c.close(false)
+			return
+		}
+	}
+}
+
+// forward writes data to dst, applying the fault if it hits. Returns false if
+// the connection was closed by the fault.
+func (c *proxyConn) forward(dir Direction, dst *net.TCPConn, data []byte) (bool, error) {
+	n, f, release := c.p.admit(dir, len(data))
+	if n > 0 {
+		if _, err := dst.Write(data[:n]); err != nil {
+			return true, err
+		}
+	}
+	if f == nil {
+		return true, nil
+	}
+	switch f.Kind {
+	case Drop:
+		c.close(false)
+		return false, nil
+	case Reset:
+		c.close(true)
+		return false, nil
+	}
+	// Stall until the fault is cleared or the proxy is closed.
+	<-release
+	_, err := dst.Write(data[n:])
+	return true, err
+}
@@ -0,0 +1,85 @@
+package kvtests
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/visvasity/kv"
+	"github.com/visvasity/kvtests/faultproxy"
+)
+
+// FaultProxied is an optional interface implemented by kv.Database adapters
+// for remote databases whose client connects to the server through a
+// faultproxy.Proxy. Network fault tests are skipped for databases that do not
+// implement it.
+type FaultProxied interface {
+	kv.Database
+
+	// FaultProxy returns the proxy between the client and the server.
+	FaultProxy() *faultproxy.Proxy
+}
+
+const (
+	// faultTimeout bounds operations that are hit by a stall fault.
+	faultTimeout = time.Second
+
+	// faultRecoveryWait is how long the database is given to recover from a
+	// fault before the test is failed.
+	faultRecoveryWait = 10 * time.Second
+)
+
+// faultProxy returns the proxy of the database or skips the test if the
+// database doesn't implement the FaultProxied interface.
+func faultProxy(t testing.TB, db kv.Database) *faultproxy.Proxy {
+	t.Helper()
+
+	p, ok := databaseAs[FaultProxied](db)
+	if !ok {
+		t.Skipf("database type %T does not implement the FaultProxied interface", db)
+	}
+	return p.FaultProxy()
+}
+
+// readAfterFault reads the key in a new snapshot after a fault has been
+// cleared. Reads are retried until the database recovers from the fault.
+// Returns false if the key doesn't exist.
+func readAfterFault(ctx context.Context, t testing.TB, db kv.Database, key string) (string, bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(faultRecoveryWait)
+	for {
+		value, err := readSnapshot(ctx, db, key)
+		if err == nil {
+			return value, true
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			return "", false
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("database did not recover in %v after a fault was cleared: %v", faultRecoveryWait, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func readSnapshot(ctx context.Context, db kv.Database, key string) (string, error) {
+	snap, err := db.NewSnapshot(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer snap.Discard(ctx)
+
+	r, err := snap.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,134 @@
+package kvtests
+
+import (
+	"encoding/json"
+	"math"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// histogramSubBits is the number of bits of precision kept for every recorded
+// value, which bounds the relative error of quantiles to 1/2^(histogramSubBits-1).
+const histogramSubBits = 7
+
+// histogramBuckets is the number of buckets needed to cover all uint64 values.
+const histogramBuckets = 1<<histogramSubBits + (64-histogramSubBits)<<(histogramSubBits-1)
+
+// Histogram is a fixed-size, log-linear histogram of durations in the style of
+// HdrHistogram. Every power-of-two range of values is split into the same
+// number of linear buckets, so quantiles have a bounded relative error (under
+// 2%) at any magnitude. A Histogram is safe for concurrent use; the zero
+// value is an empty histogram.
+type Histogram struct {
+	counts [histogramBuckets]atomic.Uint64
+	total  atomic.Uint64
+	sum    atomic.Uint64
+}
+
+func histogramIndex(v uint64) int {
+	if v < 1<<histogramSubBits {
+		return int(v)
+	}
+	e := bits.Len64(v) - histogramSubBits
+	return 1<<histogramSubBits + (e-1)<<(histogramSubBits-1) + int(v>>e) - 1<<(histogramSubBits-1)
+}
+
+// histogramValue returns the largest value that maps to the bucket index.
+func histogramValue(i int) uint64 {
+	if i < 1<<histogramSubBits {
+		return uint64(i)
+	}
+	i -= 1 << histogramSubBits
+	e := i>>(histogramSubBits-1) + 1
+	m := uint64(i&(1<<(histogramSubBits-1)-1)) + 1<<(histogramSubBits-1)
+	return (m+1)<<e - 1
+}
+
+// Record adds a duration to the histogram. Negative durations are recorded as
+// zero.
+func (h *Histogram) Record(d time.Duration) {
+	v := uint64(max(d, 0))
+	h.counts[histogramIndex(v)].Add(1)
+	h.total.Add(1)
+	h.sum.Add(v)
+}
+
+// Count returns the number of recorded durations.
+func (h *Histogram) Count() uint64 {
+	return h.total.Load()
+}
+
+// Mean returns the average of the recorded durations.
+func (h *Histogram) Mean() time.Duration {
+	n := h.total.Load()
+	if n == 0 {
+		return 0
+	}
+	return time.Duration(h.sum.Load() / n)
+}
+
+// Quantile returns an upper bound of the q-th quantile (0 <= q <= 1) of the
+// recorded durations, or zero if the histogram is empty.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	n := h.total.Load()
+	if n == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(n)))
+	rank = min(max(rank, 1), n)
+
+	var seen uint64
+	for i := range h.counts {
+		if seen += h.counts[i].Load(); seen >= rank {
+			return time.Duration(min(histogramValue(i), math.MaxInt64))
+		}
+	}
+	return time.Duration(min(histogramValue(histogramBuckets-1), math.MaxInt64))
+}
+
+// Max returns an upper bound of the largest recorded duration.
+func (h *Histogram) Max() time.Duration {
+	return h.Quantile(1)
+}
+
+// Merge adds all durations recorded in the other histogram to this histogram.
+func (h *Histogram) Merge(other *Histogram) {
+	for i := range other.counts {
+		if n := other.counts[i].Load(); n > 0 {
+			h.counts[i].Add(n)
+		}
+	}
+	h.total.Add(other.total.Load())
+	h.sum.Add(other.sum.Load())
+}
+
+// HistogramSummary is the summary of a Histogram with durations in
+// nanoseconds.
+type HistogramSummary struct {
+	Count uint64 `json:"count"`
+	Mean  int64  `json:"mean_ns"`
+	P50   int64  `json:"p50_ns"`
+	P90   int64  `json:"p90_ns"`
+	P99   int64  `json:"p99_ns"`
+	P999  int64  `json:"p999_ns"`
+	Max   int64  `json:"max_ns"`
+}
+
+// Summary returns the summary of the recorded durations.
+func (h *Histogram) Summary() HistogramSummary {
+	return HistogramSummary{
+		Count: h.Count(),
+		Mean:  int64(h.Mean()),
+		P50:   int64(h.Quantile(0.5)),
+		P90:   int64(h.Quantile(0.9)),
+		P99:   int64(h.Quantile(0.99)),
+		P999:  int64(h.Quantile(0.999)),
+		Max:   int64(h.Max()),
+	}
+}
+
+// MarshalJSON encodes the histogram as its summary.
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.Summary())
+}
@@ -0,0 +1,94 @@
+package kvtests
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	// Small values have a bucket each.
+	for v := range uint64(1 << histogramSubBits) {
+		if i := histogramIndex(v); i != int(v) || histogramValue(i) != v {
+			t.Fatalf("value %d maps to bucket %d with upper bound %d; want bucket %d", v, i, histogramValue(i), v)
+		}
+	}
+
+	// Every bucket covers the values from the end of the previous bucket to its
+	// upper bound, within the relative error bound.
+	const maxError = 1.0 / (1 << (histogramSubBits - 1))
+	for i := 1; i < histogramBuckets; i++ {
+		lo, hi := histogramValue(i-1)+1, histogramValue(i)
+		if hi < lo {
+			t.Fatalf("bucket %d has upper bound %d below the upper bound %d of bucket %d", i, hi, lo-1, i-1)
+		}
+		for _, v := range []uint64{lo, lo + (hi-lo)/2, hi} {
+			if got := histogramIndex(v); got != i {
+				t.Fatalf("value %d maps to bucket %d; want %d", v, got, i)
+			}
+		}
+		if e := float64(hi-lo) / float64(lo); e > maxError {
+			t.Fatalf("bucket %d [%d, %d] has relative error %g; want at most %g", i, lo, hi, e, maxError)
+		}
+	}
+	if got := histogramValue(histogramBuckets - 1); got != math.MaxUint64 {
+		t.Errorf("last bucket has upper bound %d; want %d", got, uint64(math.MaxUint64))
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	var h Histogram
+	if h.Quantile(0.5) != 0 || h.Mean() != 0 || h.Count() != 0 {
+		t.Fatalf("empty histogram has p50 %v, mean %v and count %d; want zeros", h.Quantile(0.5), h.Mean(), h.Count())
+	}
+
+	for v := 1; v <= 1000; v++ {
+		h.Record(time.Duration(v) * time.Microsecond)
+	}
+	if h.Count() != 1000 {
+		t.Errorf("Count() = %d; want 1000", h.Count())
+	}
+	if got, want := h.Mean(), 500500*time.Nanosecond; got != want {
+		t.Errorf("Mean() = %v; want %v", got, want)
+	}
+	for _, tc := range []struct {
+		q    float64
+		want time.Duration
+	}{
+		{0, time.Microsecond},
+		{0.5, 500 * time.Microsecond},
+		{0.9, 900 * time.Microsecond},
+		{0.99, 990 * time.Microsecond},
+		{1, 1000 * time.Microsecond},
+	} {
+		got := h.Quantile(tc.q)
+		if got < tc.want || float64(got-tc.want) > 0.02*float64(tc.want) {
+			t.Errorf("Quantile(%g) = %v; want an upper bound of %v within 2%%", tc.q, got, tc.want)
+		}
+	}
+	if h.Max() != h.Quantile(1) {
+		t.Errorf("Max() = %v; want Quantile(1) = %v", h.Max(), h.Quantile(1))
+	}
+
+	h.Record(-time.Second)
+	if got := h.Quantile(0); got != 0 {
+		t.Errorf("Quantile(0) after recording a negative duration = %v; want 0", got)
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	var a, b Histogram
+	for v := range 100 {
+		a.Record(time.Duration(v) * time.Millisecond)
+		b.Record(time.Duration(v+100) * time.Millisecond)
+	}
+	a.Merge(&b)
+
+	var want Histogram
+	for v := range 200 {
+		want.Record(time.Duration(v) * time.Millisecond)
+	}
+	if got, want := a.Summary(), want.Summary(); got != want {
+		t.Errorf("Summary() after Merge = %+v; want %+v", got, want)
+	}
+}
@@ -0,0 +1,222 @@
+package kvhttp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/visvasity/kv"
+	"github.com/visvasity/kvtests"
+)
+
+// Client is a kv.Database that runs all operations on a remote database served
+// by a Handler.
+type Client struct {
+	base string
+	hc   *http.Client
+}
+
+// NewClient returns a client for the Handler at the base URL, such as
+// "http://127.0.0.1:8080/kv". If hc is nil, http.DefaultClient is used.
+func NewClient(baseURL string, hc *http.Client) *Client {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return &Client{base: strings.TrimSuffix(baseURL, "/"), hc: hc}
+}
+
+// do sends a request for the path and query and returns the response if it
+// was successful. The caller must close the response body.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body io.Reader, header http.Header) (*http.Response, error) {
+	u := c.base + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		return nil, readError(resp)
+	}
+	return resp, nil
+}
+
+// call sends a request and reads the whole response body.
+func (c *Client) call(ctx context.Context, method, path string, query url.Values, body io.Reader, header http.Header) ([]byte, error) {
+	resp, err := c.do(ctx, method, path, query, body, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// CloseIdleConnections closes the connections to the server that are kept
+// for reuse, as http.Client.CloseIdleConnections does.
+func (c *Client) CloseIdleConnections() {
+	c.hc.CloseIdleConnections()
+}
+
+func (c *Client) NewTransaction(ctx context.Context) (kv.Transaction, error) {
+	id, err := c.call(ctx, http.MethodPost, "/transactions", nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &transaction{remote{c: c, path: "/transactions/" + string(id)}}, nil
+}
+
+func (c *Client) NewSnapshot(ctx context.Context) (kv.Snapshot, error) {
+	id, err := c.call(ctx, http.MethodPost, "/snapshots", nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot{remote{c: c, path: "/snapshots/" + string(id)}}, nil
+}
+
+// remote implements the read operations of transactions and snapshots.
+type remote struct {
+	c    *Client
+	path string
+}
+
+// Get returns the value of the key. The value is read completely before Get
+// returns, so that transport errors are reported by Get.
+func (r *remote) Get(ctx context.Context, key string) (io.Reader, error) {
+	data, err := r.c.call(ctx, http.MethodGet, r.path+"/value", url.Values{"key": {key}}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+func (r *remote) Ascend(ctx context.Context, beg, end string, errp *error) iter.Seq2[string, io.Reader] {
+	return r.scan(ctx, "ascend", beg, end, errp)
+}
+
+func (r *remote) Descend(ctx context.Context, beg, end string, errp *error) iter.Seq2[string, io.Reader] {
+	return r.scan(ctx, "descend", beg, end, errp)
+}
+
+// scan streams the range from the server. Items are read from the response as
+// the iteration proceeds; breaking out of the loop closes the response.
+func (r *remote) scan(ctx context.Context, order, beg, end string, errp *error) iter.Seq2[string, io.Reader] {
+	return func(yield func(string, io.Reader) bool) {
+		query := url.Values{"order": {order}, "begin": {beg}, "end": {end}}
+		resp, err := r.c.do(ctx, http.MethodGet, r.path+"/range", query, nil, nil)
+		if err != nil {
+			*errp = err
+			return
+		}
+		defer resp.Body.Close()
+
+		br := bufio.NewReader(resp.Body)
+		for {
+			typ, a, b, err := readFrame(br)
+			if err != nil {
+				*errp = err
+				return
+			}
+			switch typ {
+			case endFrame:
+				return
+			case errorFrame:
+				*errp = &RemoteError{Class: parseClass(string(a)), Message: string(b)}
+				return
+			}
+			if !yield(string(a), bytes.NewReader(b)) {
+				return
+			}
+		}
+	}
+}
+
+type transaction struct {
+	remote
+}
+
+func (t *transaction) Set(ctx context.Context, key string, value io.Reader) error {
+	header := make(http.Header)
+	if value == nil {
+		header.Set(nilValueHeader, "1")
+	}
+	_, err := t.c.call(ctx, http.MethodPut, t.path+"/value", url.Values{"key": {key}}, value, header)
+	return err
+}
+
+func (t *transaction) Delete(ctx context.Context, key string) error {
+	_, err := t.c.call(ctx, http.MethodDelete, t.path+"/value", url.Values{"key": {key}}, nil, nil)
+	return err
+}
+
+// Commit commits the transaction. If the commit request or its response is
+// lost, Commit resolves the outcome of the transaction with the server, so
+// that a failed Commit never applies the transaction. Returns an error
+// matching kvtests.ErrUnknownOutcome if the outcome can't be resolved before
+// the context is done.
+func (t *transaction) Commit(ctx context.Context) error {
+	_, err := t.c.call(ctx, http.MethodPost, t.path+"/commit", nil, nil, nil)
+	var rerr *RemoteError
+	if err == nil || errors.As(err, &rerr) {
+		return err
+	}
+	return t.resolve(ctx, err)
+}
+
+// resolve queries the outcome of a commit that failed with the transport error
+// commitErr until the server responds or the context is done.
+func (t *transaction) resolve(ctx context.Context, commitErr error) error {
+	for backoff := 10 * time.Millisecond; ; backoff = min(2*backoff, time.Second) {
+		body, err := t.c.call(ctx, http.MethodPost, t.path+"/resolve", nil, nil, nil)
+		var rerr *RemoteError
+		switch {
+		case err == nil && string(body) == outcomeCommitted:
+			return nil
+		case err == nil:
+			// The commit request was never received and can't be applied
+			// anymore.
+			return commitErr
+		case errors.As(err, &rerr):
+			// The commit request was received, but failed.
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("kvhttp: %w: %w", kvtests.ErrUnknownOutcome, commitErr)
+		case <-timer.C:
+		}
+	}
+}
+
+func (t *transaction) Rollback(ctx context.Context) error {
+	_, err := t.c.call(ctx, http.MethodPost, t.path+"/rollback", nil, nil, nil)
+	return err
+}
+
+type snapshot struct {
+	remote
+}
+
+func (s *snapshot) Discard(ctx context.Context) error {
+	_, err := s.c.call(ctx, http.MethodPost, s.path+"/discard", nil, nil, nil)
+	return err
+}
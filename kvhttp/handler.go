@@ -0,0 +1,365 @@
+package kvhttp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/visvasity/kv"
+)
+
+// Handler is an http.Handler that exposes a kv.Database to Clients.
+//
+// Transactions and snapshots are kept by the Handler even after they are
+// committed, rolled back or discarded, so that later calls on them return the
+// same results as the database itself would. The Handler is meant for tests
+// and does not limit the number of transactions and snapshots it keeps.
+type Handler struct {
+	db  kv.Database
+	mux *http.ServeMux
+
+	mu      sync.Mutex
+	closed  bool
+	nextID  int64
+	handles map[string]*handle
+}
+
+// handle is a transaction or a snapshot of a client. Operations on a handle
+// are serialized, as they would be in a single-threaded client.
+type handle struct {
+	mu   sync.Mutex
+	tx   kv.Transaction
+	snap kv.Snapshot
+	done bool // Commit, Rollback or Discard was called
+
+	committed bool  // a commit request was received
+	commitErr error // result of the last commit request
+	aborted   bool  // rolled back by a resolve request
+}
+
+func (h *handle) reader() kv.Reader {
+	if h.tx != nil {
+		return h.tx
+	}
+	return h.snap
+}
+
+// NewHandler returns a handler that serves the database.
+func NewHandler(db kv.Database) *Handler {
+	h := &Handler{
+		db:      db,
+		mux:     http.NewServeMux(),
+		handles: make(map[string]*handle),
+	}
+	h.mux.HandleFunc("POST /transactions", h.newTransaction)
+	h.mux.HandleFunc("POST /snapshots", h.newSnapshot)
+	h.mux.HandleFunc("GET /{kind}/{id}/value", h.get)
+	h.mux.HandleFunc("PUT /transactions/{id}/value", h.set)
+	h.mux.HandleFunc("DELETE /transactions/{id}/value", h.delete)
+	h.mux.HandleFunc("GET /{kind}/{id}/range", h.scan)
+	h.mux.HandleFunc("POST /transactions/{id}/commit", h.commit)
+	h.mux.HandleFunc("POST /transactions/{id}/rollback", h.rollback)
+	h.mux.HandleFunc("POST /transactions/{id}/resolve", h.resolve)
+	h.mux.HandleFunc("POST /snapshots/{id}/discard", h.discard)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// Close rolls back all transactions and discards all snapshots that are still
+// open. Requests after Close fail with os.ErrClosed.
+func (h *Handler) Close() error {
+	h.mu.Lock()
+	h.closed = true
+	handles := h.handles
+	h.handles = make(map[string]*handle)
+	h.mu.Unlock()
+
+	ctx := context.Background()
+	for _, v := range handles {
+		v.mu.Lock()
+		if !v.done {
+			v.done = true
+			if v.tx != nil {
+				v.tx.Rollback(ctx)
+			} else {
+				v.snap.Discard(ctx)
+			}
+		}
+		v.mu.Unlock()
+	}
+	return nil
+}
+
+// add keeps a new handle and writes its id as the response.
+func (h *Handler) add(w http.ResponseWriter, v *handle) {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		v.done = true
+		if v.tx != nil {
+			v.tx.Rollback(context.Background())
+		} else {
+			v.snap.Discard(context.Background())
+		}
+		writeError(w, fmt.Errorf("kvhttp: handler is closed: %w", os.ErrClosed))
+		return
+	}
+	h.nextID++
+	id := strconv.FormatInt(h.nextID, 10)
+	h.handles[id] = v
+	h.mu.Unlock()
+
+	io.WriteString(w, id)
+}
+
+// lookup returns the locked handle of the request, or writes an error and
+// returns nil if the handle does not exist.
+func (h *Handler) lookup(w http.ResponseWriter, r *http.Request, kind string) *handle {
+	if kind == "" {
+		kind = r.PathValue("kind")
+	}
+	id := r.PathValue("id")
+
+	h.mu.Lock()
+	closed := h.closed
+	v, ok := h.handles[id]
+	h.mu.Unlock()
+
+	switch {
+	case closed:
+		writeError(w, fmt.Errorf("kvhttp: handler is closed: %w", os.ErrClosed))
+		return nil
+	case !ok || (kind == "transactions" && v.tx == nil) || (kind == "snapshots" && v.snap == nil):
+		writeError(w, fmt.Errorf("kvhttp: unknown %s id %q", kind, id))
+		return nil
+	}
+	v.mu.Lock()
+	return v
+}
+
+func (h *Handler) newTransaction(w http.ResponseWriter, r *http.Request) {
+	// Transactions outlive the request that created them.
+	tx, err := h.db.NewTransaction(context.WithoutCancel(r.Context()))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	h.add(w, &handle{tx: tx})
+}
+
+func (h *Handler) newSnapshot(w http.ResponseWriter, r *http.Request) {
+	snap, err := h.db.NewSnapshot(context.WithoutCancel(r.Context()))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	h.add(w, &handle{snap: snap})
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	v := h.lookup(w, r, "")
+	if v == nil {
+		return
+	}
+	defer v.mu.Unlock()
+
+	value, err := v.reader().Get(r.Context(), r.URL.Query().Get("key"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	// Read the value before the status is sent, so that read errors are
+	// reported as errors instead of truncated values. The Content-Length lets
+	// the client detect values truncated by the network.
+	data, err := io.ReadAll(value)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
+
+func (h *Handler) set(w http.ResponseWriter, r *http.Request) {
+	v := h.lookup(w, r, "transactions")
+	if v == nil {
+		return
+	}
+	defer v.mu.Unlock()
+
+	var value io.Reader = r.Body
+	if r.Header.Get(nilValueHeader) != "" {
+		value = nil
+	}
+	if err := v.tx.Set(r.Context(), r.URL.Query().Get("key"), value); err != nil {
+		writeError(w, err)
+	}
+}
+
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
+	v := h.lookup(w, r, "transactions")
+	if v == nil {
+		return
+	}
+	defer v.mu.Unlock()
+
+	if err := v.tx.Delete(r.Context(), r.URL.Query().Get("key")); err != nil {
+		writeError(w, err)
+	}
+}
+
+// scan streams a range as frames. The handle is locked only while the next
+// item is fetched, so that the client can use the transaction in the body of
+// its range loop.
+func (h *Handler) scan(w http.ResponseWriter, r *http.Request) {
+	v := h.lookup(w, r, "")
+	if v == nil {
+		return
+	}
+	locked := true
+	defer func() {
+		if locked {
+			v.mu.Unlock()
+		}
+	}()
+
+	ctx := r.Context()
+	q := r.URL.Query()
+	var iterErr error
+	var seq iter.Seq2[string, io.Reader]
+	switch order := q.Get("order"); order {
+	case "ascend":
+		seq = v.reader().Ascend(ctx, q.Get("begin"), q.Get("end"), &iterErr)
+	case "descend":
+		seq = v.reader().Descend(ctx, q.Get("begin"), q.Get("end"), &iterErr)
+	default:
+		writeError(w, fmt.Errorf("kvhttp: invalid range order %q: %w", order, os.ErrInvalid))
+		return
+	}
+
+	next, stop := iter.Pull2(seq)
+	defer func() {
+		if !locked {
+			v.mu.Lock()
+			locked = true
+		}
+		stop()
+	}()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	bw := bufio.NewWriter(w)
+	for {
+		if !locked {
+			v.mu.Lock()
+			locked = true
+		}
+		key, value, ok := next()
+		var data []byte
+		var err error
+		if ok {
+			data, err = io.ReadAll(value)
+		}
+		v.mu.Unlock()
+		locked = false
+
+		if !ok {
+			break
+		}
+		if err != nil {
+			writeErrorFrame(bw, err)
+			return
+		}
+		if err := writeItem(bw, key, data); err != nil {
+			return // client went away
+		}
+	}
+	if iterErr != nil {
+		writeErrorFrame(bw, iterErr)
+		return
+	}
+	writeEnd(bw)
+}
+
+func (h *Handler) commit(w http.ResponseWriter, r *http.Request) {
+	v := h.lookup(w, r, "transactions")
+	if v == nil {
+		return
+	}
+	defer v.mu.Unlock()
+
+	if v.aborted {
+		// A delayed commit request must not apply a transaction that was
+		// reported as not committed.
+		writeError(w, fmt.Errorf("kvhttp: transaction was rolled back after its commit request was lost: %w", os.ErrClosed))
+		return
+	}
+	v.done = true
+	v.committed = true
+	// A canceled request must not fail the commit, since the failure would be
+	// reported as definite by later resolve requests.
+	v.commitErr = v.tx.Commit(context.WithoutCancel(r.Context()))
+	if v.commitErr != nil {
+		writeError(w, v.commitErr)
+	}
+}
+
+// resolve returns the outcome of the last commit request of a transaction, or
+// rolls the transaction back if no commit request was received. A commit
+// request in progress completes before the outcome is returned.
+func (h *Handler) resolve(w http.ResponseWriter, r *http.Request) {
+	v := h.lookup(w, r, "transactions")
+	if v == nil {
+		return
+	}
+	defer v.mu.Unlock()
+
+	switch {
+	case v.committed && v.commitErr == nil:
+		io.WriteString(w, outcomeCommitted)
+	case v.committed:
+		writeError(w, v.commitErr)
+	default:
+		if !v.aborted {
+			v.aborted = true
+			v.done = true
+			v.tx.Rollback(context.WithoutCancel(r.Context()))
+		}
+		io.WriteString(w, outcomeAborted)
+	}
+}
+
+func (h *Handler) rollback(w http.ResponseWriter, r *http.Request) {
+	v := h.lookup(w, r, "transactions")
+	if v == nil {
+		return
+	}
+	defer v.mu.Unlock()
+
+	v.done = true
+	if err := v.tx.Rollback(r.Context()); err != nil {
+		writeError(w, err)
+	}
+}
+
+func (h *Handler) discard(w http.ResponseWriter, r *http.Request) {
+	v := h.lookup(w, r, "snapshots")
+	if v == nil {
+		return
+	}
+	defer v.mu.Unlock()
+
+	v.done = true
+	if err := v.snap.Discard(r.Context()); err != nil {
+		writeError(w, err)
+	}
+}
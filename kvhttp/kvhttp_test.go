@@ -0,0 +1,58 @@
+package kvhttp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/visvasity/kv"
+	"github.com/visvasity/kvmemdb"
+	"github.com/visvasity/kvtests"
+	"github.com/visvasity/kvtests/conform"
+	_ "github.com/visvasity/kvtests/conform/memdb"
+	"github.com/visvasity/kvtests/kvhttp"
+)
+
+// TestDiffRun verifies that kvmemdb behaves the same with and without a kvhttp
+// server in between.
+func TestDiffRun(t *testing.T) {
+	ctx := context.Background()
+
+	l, err := kvhttp.NewLoopback(kv.DatabaseFrom(kvmemdb.New()))
+	if err != nil {
+		t.Fatalf("NewLoopback: %v", err)
+	}
+	defer l.Close()
+
+	db := kv.DatabaseFrom(kvmemdb.New())
+	for seed := range uint64(10) {
+		kvtests.DiffRun(ctx, t, db, l, kvtests.RandomDiffWorkload(seed, "/TestDiffRun/", 200))
+	}
+}
+
+// TestSuite runs the kvtests suite against kvmemdb served over kvhttp, with
+// the capabilities, error classes and expectations of the kvhttp-kvmemdb
+// conformance backend.
+func TestSuite(t *testing.T) {
+	ctx := context.Background()
+
+	var backend conform.Backend
+	for _, b := range conform.Backends() {
+		if b.Name == "kvhttp-kvmemdb" {
+			backend = b
+		}
+	}
+	if backend.Name == "" {
+		t.Fatalf("kvhttp-kvmemdb backend is not registered")
+	}
+
+	l, err := kvhttp.NewLoopback(kv.DatabaseFrom(kvmemdb.New()))
+	if err != nil {
+		t.Fatalf("NewLoopback: %v", err)
+	}
+	defer l.Close()
+
+	kvtests.Run(ctx, t, l,
+		kvtests.WithCapabilities(*backend.Capabilities),
+		kvtests.WithErrorClassifier(backend.Classify),
+		kvtests.WithExpectations(backend.Expectations))
+}
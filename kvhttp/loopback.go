@@ -0,0 +1,65 @@
+package kvhttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/visvasity/kv"
+)
+
+// Loopback is a Client connected to a Handler for a database served on a
+// local TCP port by the same process. It is used to run the kvtests suite for
+// a database across a remote boundary.
+type Loopback struct {
+	*Client
+
+	addr    string
+	handler *Handler
+	server  *http.Server
+	done    chan error
+}
+
+// NewLoopback serves the database on a random local port and returns a client
+// for it. The returned Loopback must be closed to stop the server.
+func NewLoopback(db kv.Database) (*Loopback, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	h := NewHandler(db)
+	lb := &Loopback{
+		addr:    l.Addr().String(),
+		handler: h,
+		server: &http.Server{
+			Handler:  h,
+			ErrorLog: log.New(io.Discard, "", 0),
+		},
+		done: make(chan error, 1),
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 64
+	lb.Client = NewClient("http://"+lb.addr, &http.Client{Transport: transport})
+
+	go func() { lb.done <- lb.server.Serve(l) }()
+	return lb, nil
+}
+
+// Addr returns the address of the local server.
+func (lb *Loopback) Addr() string {
+	return lb.addr
+}
+
+// Close stops the server and closes the handler, which rolls back all open
+// transactions and discards all open snapshots.
+func (lb *Loopback) Close() error {
+	err := lb.server.Shutdown(context.Background())
+	if serr := <-lb.done; !errors.Is(serr, http.ErrServerClosed) {
+		err = errors.Join(err, serr)
+	}
+	lb.Client.hc.CloseIdleConnections()
+	return errors.Join(err, lb.handler.Close())
+}
@@ -0,0 +1,220 @@
+// Package kvhttp exposes a kv.Database over HTTP and implements a kv.Database
+// client for it, so that the kvtests suite can verify that the semantics of an
+// implementation survive a remote boundary.
+//
+// The server side is a Handler that keeps the transactions and snapshots of
+// its clients by id:
+//
+//	POST   /transactions               begin a transaction; returns its id
+//	POST   /snapshots                  create a snapshot; returns its id
+//	GET    /{kind}/{id}/value?key=K    read a value; the body is the value
+//	PUT    /transactions/{id}/value?key=K
+//	DELETE /transactions/{id}/value?key=K
+//	GET    /{kind}/{id}/range?begin=B&end=E&order=ascend|descend
+//	POST   /transactions/{id}/commit
+//	POST   /transactions/{id}/rollback
+//	POST   /transactions/{id}/resolve  settle the outcome of a lost commit
+//	POST   /snapshots/{id}/discard
+//
+// where kind is transactions or snapshots. Values are streamed as request and
+// response bodies. Failed operations return a non-2xx status with the
+// kvtests.ErrorClass of the error in the Kvhttp-Error-Class header and the
+// error message as the body, so that clients can return errors of the same
+// class. Ranges are returned as a stream of frames (see writeItem), which
+// ends with either an end frame or an error frame.
+//
+// When a commit request or its response is lost, the client resolves the
+// outcome of the transaction: the server returns the result of the commit if
+// it was received, or else rolls the transaction back, so that a delayed
+// commit request can never apply it. If the outcome can't be resolved before
+// the context is done, Commit returns an error matching
+// kvtests.ErrUnknownOutcome.
+package kvhttp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/visvasity/kvtests"
+)
+
+const (
+	// errorClassHeader holds the kvtests.ErrorClass of a failed operation.
+	errorClassHeader = "Kvhttp-Error-Class"
+
+	// nilValueHeader marks a Set request with a nil value, which is different
+	// from an empty value.
+	nilValueHeader = "Kvhttp-Nil-Value"
+)
+
+// Bodies of successful resolve responses.
+const (
+	outcomeCommitted = "committed"
+	outcomeAborted   = "aborted"
+)
+
+// Frame types of a range response.
+const (
+	itemFrame  byte = 'i'
+	errorFrame byte = 'e'
+	endFrame   byte = '.'
+)
+
+// statusOf returns the HTTP status code for errors of the class.
+func statusOf(class kvtests.ErrorClass) int {
+	switch class {
+	case kvtests.ClassConflict:
+		return http.StatusConflict
+	case kvtests.ClassUnknownOutcome:
+		return http.StatusGatewayTimeout
+	case kvtests.ClassClosed:
+		return http.StatusGone
+	case kvtests.ClassInvalid:
+		return http.StatusBadRequest
+	case kvtests.ClassNotExist:
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// sentinelOf returns the error that errors of the class wrap, or nil for the
+// fatal class.
+func sentinelOf(class kvtests.ErrorClass) error {
+	switch class {
+	case kvtests.ClassConflict:
+		return kvtests.ErrConflict
+	case kvtests.ClassUnknownOutcome:
+		return kvtests.ErrUnknownOutcome
+	case kvtests.ClassClosed:
+		return os.ErrClosed
+	case kvtests.ClassInvalid:
+		return os.ErrInvalid
+	case kvtests.ClassNotExist:
+		return os.ErrNotExist
+	}
+	return nil
+}
+
+// parseClass returns the error class with the given name. Unknown names are
+// treated as fatal.
+func parseClass(name string) kvtests.ErrorClass {
+	for c := kvtests.ClassConflict; c < kvtests.ClassFatal; c++ {
+		if c.String() == name {
+			return c
+		}
+	}
+	return kvtests.ClassFatal
+}
+
+// RemoteError is an error returned by the server. It matches the sentinel
+// error of its class (for example, kvtests.ErrConflict or os.ErrNotExist)
+// with errors.Is.
+type RemoteError struct {
+	Class   kvtests.ErrorClass
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return e.Message
+}
+
+func (e *RemoteError) Unwrap() error {
+	return sentinelOf(e.Class)
+}
+
+// writeError writes an error response for the error.
+func writeError(w http.ResponseWriter, err error) {
+	class := kvtests.Classify(err)
+	w.Header().Set(errorClassHeader, class.String())
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(statusOf(class))
+	io.WriteString(w, err.Error())
+}
+
+// readError returns the error of a non-2xx response.
+func readError(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	class := resp.Header.Get(errorClassHeader)
+	if class == "" {
+		// Not a response from the Handler, for example, from a proxy.
+		return fmt.Errorf("kvhttp: unexpected response %q: %s", resp.Status, msg)
+	}
+	return &RemoteError{Class: parseClass(class), Message: string(msg)}
+}
+
+// writeItem writes an item frame, which holds the length prefixed key and
+// value of a range item. Items are buffered; the buffer is flushed by the
+// final end or error frame.
+func writeItem(w *bufio.Writer, key string, value []byte) error {
+	w.WriteByte(itemFrame)
+	writeBytes(w, []byte(key))
+	return writeBytes(w, value)
+}
+
+// writeErrorFrame writes an error frame, which holds the length prefixed error
+// class name and message of an iteration error.
+func writeErrorFrame(w *bufio.Writer, err error) error {
+	w.WriteByte(errorFrame)
+	writeBytes(w, []byte(kvtests.Classify(err).String()))
+	writeBytes(w, []byte(err.Error()))
+	return w.Flush()
+}
+
+// writeEnd writes the end frame of a successful iteration.
+func writeEnd(w *bufio.Writer) error {
+	w.WriteByte(endFrame)
+	return w.Flush()
+}
+
+func writeBytes(w *bufio.Writer, data []byte) error {
+	w.Write(binary.AppendUvarint(nil, uint64(len(data))))
+	_, err := w.Write(data)
+	return err
+}
+
+// readFrame reads the next frame of a range response. For item frames, a and b
+// are the key and value; for error frames, the error class name and message.
+func readFrame(r *bufio.Reader) (typ byte, a, b []byte, err error) {
+	if typ, err = r.ReadByte(); err != nil {
+		return 0, nil, nil, unexpectedEOF(err)
+	}
+	switch typ {
+	case endFrame:
+		return typ, nil, nil, nil
+	case itemFrame, errorFrame:
+		if a, err = readBytes(r); err != nil {
+			return 0, nil, nil, err
+		}
+		if b, err = readBytes(r); err != nil {
+			return 0, nil, nil, err
+		}
+		return typ, a, b, nil
+	}
+	return 0, nil, nil, fmt.Errorf("kvhttp: invalid frame type %q", typ)
+}
+
+func readBytes(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return data, nil
+}
+
+// unexpectedEOF converts io.EOF to io.ErrUnexpectedEOF, because a range
+// response must end with an end or error frame.
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("kvhttp: range response truncated: %w", io.ErrUnexpectedEOF)
+	}
+	return err
+}
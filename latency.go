@@ -0,0 +1,264 @@
+package kvtests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/visvasity/kv"
+)
+
+// Op identifies a kv.Database operation.
+type Op int
+
+const (
+	OpNewTransaction Op = iota
+	OpNewSnapshot
+	OpGet
+	OpSet
+	OpDelete
+	OpCommit
+	OpRollback
+	OpDiscard
+
+	// OpAscendItem and OpDescendItem are the time taken to produce a single
+	// item of an Ascend or Descend iteration, excluding the time spent by the
+	// caller in the loop body.
+	OpAscendItem
+	OpDescendItem
+
+	// OpReadValue is a single Read call on a value returned by Get or by an
+	// Ascend or Descend iteration.
+	OpReadValue
+
+	numOps
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpNewTransaction:
+		return "NewTransaction"
+	case OpNewSnapshot:
+		return "NewSnapshot"
+	case OpGet:
+		return "Get"
+	case OpSet:
+		return "Set"
+	case OpDelete:
+		return "Delete"
+	case OpCommit:
+		return "Commit"
+	case OpRollback:
+		return "Rollback"
+	case OpDiscard:
+		return "Discard"
+	case OpAscendItem:
+		return "AscendItem"
+	case OpDescendItem:
+		return "DescendItem"
+	case OpReadValue:
+		return "ReadValue"
+	}
+	return fmt.Sprintf("Op(%d)", int(op))
+}
+
+// ParseOp returns the operation with the given name, as returned by
+// Op.String.
+func ParseOp(name string) (Op, error) {
+	for op := range numOps {
+		if op.String() == name {
+			return op, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown operation %q: %w", name, os.ErrInvalid)
+}
+
+// LatencyRecorder records a latency histogram for every kv.Database
+// operation performed through the databases it wraps. The zero value is ready
+// to use; a LatencyRecorder is safe for concurrent use.
+type LatencyRecorder struct {
+	hists [numOps]Histogram
+}
+
+// Histogram returns the latency histogram of the operation.
+func (r *LatencyRecorder) Histogram(op Op) *Histogram {
+	return &r.hists[op]
+}
+
+// Wrap returns a database wrapper that records the latency of every operation
+// on the database, its transactions and its snapshots, irrespective of the
+// result.
+func (r *LatencyRecorder) Wrap(db kv.Database) kv.Database {
+	return &timedDatabase{db: db, r: r}
+}
+
+func (r *LatencyRecorder) since(op Op, start time.Time) {
+	r.hists[op].Record(time.Since(start))
+}
+
+// ReportMetrics reports the p50, p99 and p999 latencies of every operation
+// that was recorded at least once as custom benchmark metrics, such as
+// Get-p99-ns.
+func (r *LatencyRecorder) ReportMetrics(b *testing.B) {
+	for op := range numOps {
+		h := &r.hists[op]
+		if h.Count() == 0 {
+			continue
+		}
+		b.ReportMetric(float64(h.Quantile(0.5)), op.String()+"-p50-ns")
+		b.ReportMetric(float64(h.Quantile(0.99)), op.String()+"-p99-ns")
+		b.ReportMetric(float64(h.Quantile(0.999)), op.String()+"-p999-ns")
+	}
+}
+
+// MarshalJSON encodes the summaries of all recorded operations as a JSON
+// object keyed by operation name.
+func (r *LatencyRecorder) MarshalJSON() ([]byte, error) {
+	m := make(map[string]HistogramSummary)
+	for op := range numOps {
+		if h := &r.hists[op]; h.Count() > 0 {
+			m[op.String()] = h.Summary()
+		}
+	}
+	return json.Marshal(m)
+}
+
+// WriteJSON writes the summaries of all recorded operations to the file in
+// JSON format, replacing the file if it exists.
+func (r *LatencyRecorder) WriteJSON(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+type timedDatabase struct {
+	db kv.Database
+	r  *LatencyRecorder
+}
+
+func (d *timedDatabase) NewTransaction(ctx context.Context) (kv.Transaction, error) {
+	defer d.r.since(OpNewTransaction, time.Now())
+	tx, err := d.db.NewTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &timedTransaction{Transaction: tx, r: d.r}, nil
+}
+
+func (d *timedDatabase) NewSnapshot(ctx context.Context) (kv.Snapshot, error) {
+	defer d.r.since(OpNewSnapshot, time.Now())
+	snap, err := d.db.NewSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &timedSnapshot{Snapshot: snap, r: d.r}, nil
+}
+
+type timedTransaction struct {
+	kv.Transaction
+
+	r *LatencyRecorder
+}
+
+func (t *timedTransaction) Get(ctx context.Context, key string) (io.Reader, error) {
+	defer t.r.since(OpGet, time.Now())
+	r, err := t.Transaction.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return t.r.reader(r), nil
+}
+
+func (t *timedTransaction) Set(ctx context.Context, key string, value io.Reader) error {
+	defer t.r.since(OpSet, time.Now())
+	return t.Transaction.Set(ctx, key, value)
+}
+
+func (t *timedTransaction) Delete(ctx context.Context, key string) error {
+	defer t.r.since(OpDelete, time.Now())
+	return t.Transaction.Delete(ctx, key)
+}
+
+func (t *timedTransaction) Ascend(ctx context.Context, beg, end string, errp *error) iter.Seq2[string, io.Reader] {
+	return t.r.timedSeq(OpAscendItem, t.Transaction.Ascend(ctx, beg, end, errp))
+}
+
+func (t *timedTransaction) Descend(ctx context.Context, beg, end string, errp *error) iter.Seq2[string, io.Reader] {
+	return t.r.timedSeq(OpDescendItem, t.Transaction.Descend(ctx, beg, end, errp))
+}
+
+func (t *timedTransaction) Commit(ctx context.Context) error {
+	defer t.r.since(OpCommit, time.Now())
+	return t.Transaction.Commit(ctx)
+}
+
+func (t *timedTransaction) Rollback(ctx context.Context) error {
+	defer t.r.since(OpRollback, time.Now())
+	return t.Transaction.Rollback(ctx)
+}
+
+type timedSnapshot struct {
+	kv.Snapshot
+
+	r *LatencyRecorder
+}
+
+func (s *timedSnapshot) Get(ctx context.Context, key string) (io.Reader, error) {
+	defer s.r.since(OpGet, time.Now())
+	r, err := s.Snapshot.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return s.r.reader(r), nil
+}
+
+func (s *timedSnapshot) Ascend(ctx context.Context, beg, end string, errp *error) iter.Seq2[string, io.Reader] {
+	return s.r.timedSeq(OpAscendItem, s.Snapshot.Ascend(ctx, beg, end, errp))
+}
+
+func (s *timedSnapshot) Descend(ctx context.Context, beg, end string, errp *error) iter.Seq2[string, io.Reader] {
+	return s.r.timedSeq(OpDescendItem, s.Snapshot.Descend(ctx, beg, end, errp))
+}
+
+func (s *timedSnapshot) Discard(ctx context.Context) error {
+	defer s.r.since(OpDiscard, time.Now())
+	return s.Snapshot.Discard(ctx)
+}
+
+// timedSeq records the time taken to produce every item of the sequence and
+// wraps every value.
+func (r *LatencyRecorder) timedSeq(op Op, seq iter.Seq2[string, io.Reader]) iter.Seq2[string, io.Reader] {
+	return func(yield func(string, io.Reader) bool) {
+		start := time.Now()
+		for key, value := range seq {
+			r.since(op, start)
+			if !yield(key, r.reader(value)) {
+				return
+			}
+			start = time.Now()
+		}
+	}
+}
+
+// reader wraps a value so that the time taken by every Read call is recorded
+// as OpReadValue.
+func (r *LatencyRecorder) reader(value io.Reader) io.Reader {
+	return &timedReader{r: value, rec: r}
+}
+
+type timedReader struct {
+	r   io.Reader
+	rec *LatencyRecorder
+}
+
+func (r *timedReader) Read(p []byte) (int, error) {
+	defer r.rec.since(OpReadValue, time.Now())
+	return r.r.Read(p)
+}
@@ -0,0 +1,61 @@
+package kvtests
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/visvasity/kv"
+	"github.com/visvasity/kvmemdb"
+)
+
+func TestLatencyRecorder(t *testing.T) {
+	ctx := context.Background()
+
+	var r LatencyRecorder
+	db := r.Wrap(kv.DatabaseFrom(kvmemdb.New()))
+
+	tx, err := db.NewTransaction(ctx)
+	if err != nil {
+		t.Fatalf("NewTransaction: %v", err)
+	}
+	if err := tx.Set(ctx, "/key", strings.NewReader("value")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	snap, err := db.NewSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("NewSnapshot: %v", err)
+	}
+	defer snap.Discard(ctx)
+
+	value, err := snap.Get(ctx, "/key")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if _, err := io.ReadAll(value); err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	var iterErr error
+	for _, value := range snap.Ascend(ctx, "", "", &iterErr) {
+		if _, err := io.ReadAll(value); err != nil {
+			t.Fatalf("ReadAll: %v", err)
+		}
+	}
+	if iterErr != nil {
+		t.Fatalf("Ascend: %v", iterErr)
+	}
+
+	for _, op := range []Op{OpNewTransaction, OpSet, OpCommit, OpNewSnapshot, OpGet, OpAscendItem, OpReadValue} {
+		if r.Histogram(op).Count() == 0 {
+			t.Errorf("no %v latency was recorded", op)
+		}
+	}
+	if n := r.Histogram(OpReadValue).Count(); n < 4 {
+		t.Errorf("%d ReadValue latencies were recorded; want at least one per Read call of two values", n)
+	}
+}
@@ -0,0 +1,161 @@
+package kvtests
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/visvasity/kv"
+)
+
+// leakSettleTimeout is the maximum time to wait for goroutines and file
+// descriptors released asynchronously by a backend.
+const leakSettleTimeout = 2 * time.Second
+
+// LeakCheck wraps a test function so that the test fails if the goroutines or
+// file descriptors in use after the test function returns are not the same as
+// before it was called. Stack traces of the leaked goroutines and the targets
+// of leaked file descriptors are reported.
+//
+// Backends release resources asynchronously at times, so the check is retried
+// for a short while before the test is failed. Databases that keep idle network
+// connections for reuse can release them before the check with a
+// CloseIdleConnections method, like the one of http.Client. File descriptors
+// are checked only on platforms with /proc/self/fd.
+func LeakCheck(fn TestFunc) TestFunc {
+	return func(ctx context.Context, t *testing.T, db kv.Database) {
+		initPoller()
+		goroutines := goroutineStacks()
+		fds, fdsOK := openFDs()
+
+		defer func() {
+			if c, ok := databaseAs[interface{ CloseIdleConnections() }](db); ok {
+				c.CloseIdleConnections()
+			}
+
+			var leakedGoroutines []string
+			var leakedFDs []string
+			for deadline := time.Now().Add(leakSettleTimeout); ; {
+				leakedGoroutines = newGoroutines(goroutines)
+				if fdsOK {
+					after, _ := openFDs()
+					leakedFDs = newFDs(fds, after)
+				}
+				if len(leakedGoroutines) == 0 && len(leakedFDs) == 0 {
+					return
+				}
+				if time.Now().After(deadline) {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			if len(leakedGoroutines) > 0 {
+				t.Errorf("%d goroutine(s) leaked:\n\n%s", len(leakedGoroutines), strings.Join(leakedGoroutines, "\n\n"))
+			}
+			if len(leakedFDs) > 0 {
+				t.Errorf("%d file descriptor(s) leaked: %s", len(leakedFDs), strings.Join(leakedFDs, ", "))
+			}
+		}()
+
+		fn(ctx, t, db)
+	}
+}
+
+var pollerOnce sync.Once
+
+// initPoller makes the runtime open the descriptors of its network poller,
+// which it does when the first pollable file is opened, so that they are not
+// reported as leaked by the first test that opens a file.
+func initPoller() {
+	pollerOnce.Do(func() {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return
+		}
+		r.Close()
+		w.Close()
+	})
+}
+
+// goroutineStacks returns the stack traces of all goroutines keyed by their
+// header line, which includes the goroutine id.
+func goroutineStacks() map[string]string {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	stacks := make(map[string]string)
+	for _, g := range bytes.Split(buf, []byte("\n\n")) {
+		header, _, _ := bytes.Cut(g, []byte("\n"))
+		id, _, ok := strings.Cut(string(header), " [")
+		if !ok {
+			continue
+		}
+		stacks[id] = string(g)
+	}
+	return stacks
+}
+
+// newGoroutines returns the stack traces of goroutines that are not in the
+// before set.
+func newGoroutines(before map[string]string) []string {
+	var leaked []string
+	for id, stack := range goroutineStacks() {
+		if _, ok := before[id]; ok {
+			continue
+		}
+		leaked = append(leaked, stack)
+	}
+	slices.Sort(leaked)
+	return leaked
+}
+
+// openFDs returns the open file descriptors of the process with their
+// targets. Returns false if open file descriptors cannot be listed.
+func openFDs() (map[string]string, bool) {
+	const dir = "/proc/self/fd"
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, false
+	}
+	fds := make(map[string]string)
+	for _, e := range entries {
+		target, err := os.Readlink(filepath.Join(dir, e.Name()))
+		if err != nil {
+			// The descriptor used to read the directory is already closed.
+			continue
+		}
+		fds[e.Name()] = target
+	}
+	return fds, true
+}
+
+// newFDs returns the descriptions of file descriptors in after that are not in
+// before or that now refer to a different file.
+func newFDs(before, after map[string]string) []string {
+	var leaked []string
+	for fd, target := range after {
+		if t, ok := before[fd]; ok && t == target {
+			continue
+		}
+		leaked = append(leaked, fmt.Sprintf("fd %s -> %s", fd, target))
+	}
+	slices.Sort(leaked)
+	return leaked
+}
@@ -0,0 +1,76 @@
+package kvtests
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/visvasity/kv"
+	"github.com/visvasity/kvmemdb"
+)
+
+// leakChildEnv makes TestLeakCheckReportsLeaks run the leaking case.
+const leakChildEnv = "KVTESTS_LEAK_CHILD"
+
+func TestLeakCheckReportsLeaks(t *testing.T) {
+	db := kv.DatabaseFrom(kvmemdb.New())
+
+	if path := os.Getenv(leakChildEnv); path != "" {
+		leaky := func(ctx context.Context, t *testing.T, db kv.Database) {
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			// The goroutine keeps the file from being closed by the garbage
+			// collector.
+			block := make(chan struct{})
+			go func() {
+				<-block
+				f.Close()
+			}()
+		}
+		LeakCheck(leaky)(context.Background(), t, db)
+		return
+	}
+
+	path := filepath.Join(t.TempDir(), "leaked")
+	cmd := exec.Command(os.Args[0], "-test.run="+exactTestPattern(t.Name()), "-test.count=1", "-test.v")
+	cmd.Env = append(os.Environ(), leakChildEnv+"="+path)
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("leaking case passed; output:\n%s", output)
+	}
+	for _, want := range []string{"--- FAIL: " + t.Name(), "1 goroutine(s) leaked", "1 file descriptor(s) leaked", path} {
+		if !strings.Contains(string(output), want) {
+			t.Errorf("output of the leaking case doesn't contain %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestLeakCheckWaitsForRelease(t *testing.T) {
+	db := kv.DatabaseFrom(kvmemdb.New())
+
+	// The goroutine and the file are released asynchronously, within the
+	// retry window of LeakCheck.
+	const release = 200 * time.Millisecond
+	clean := func(ctx context.Context, t *testing.T, db kv.Database) {
+		f, err := os.Create(filepath.Join(t.TempDir(), "released"))
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		go func() {
+			time.Sleep(release)
+			f.Close()
+		}()
+	}
+
+	start := time.Now()
+	LeakCheck(clean)(context.Background(), t, db)
+	if d := time.Since(start); d < release || d >= leakSettleTimeout {
+		t.Errorf("LeakCheck returned after %v; want between %v and %v", d, release, leakSettleTimeout)
+	}
+}
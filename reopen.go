@@ -0,0 +1,43 @@
+package kvtests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/visvasity/kv"
+)
+
+// Reopener is an optional interface implemented by kv.Database adapters for
+// persistent databases. Durability tests are skipped for databases that do not
+// implement it.
+type Reopener interface {
+	kv.Database
+
+	// Reopen closes the underlying storage and opens the same storage again. All
+	// transactions and snapshots created before Reopen are abandoned. After a
+	// successful return, the receiver must serve requests from the reopened
+	// storage.
+	Reopen(ctx context.Context) error
+}
+
+// reopener returns the Reopener of the database or skips the test if the
+// database doesn't implement the Reopener interface. Tests call it before they
+// create any transactions or snapshots.
+func reopener(t testing.TB, db kv.Database) Reopener {
+	t.Helper()
+
+	r, ok := databaseAs[Reopener](db)
+	if !ok {
+		t.Skipf("database type %T does not implement the Reopener interface", db)
+	}
+	return r
+}
+
+// reopen closes and reopens the database.
+func reopen(ctx context.Context, t testing.TB, r Reopener) {
+	t.Helper()
+
+	if err := r.Reopen(ctx); err != nil {
+		t.Fatalf("Reopen: %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package kvtests
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/visvasity/kv"
+)
+
+// RetryOptions configures RunInTransaction. Zero fields take default values.
+type RetryOptions struct {
+	// MaxAttempts is the maximum number of transactions to try. Default is 10.
+	MaxAttempts int
+
+	// InitialBackoff is the maximum delay before the second attempt. The maximum
+	// delay doubles after every failed attempt. Default is 1ms.
+	InitialBackoff time.Duration
+
+	// MaxBackoff is the upper limit for the delay between attempts. Default is
+	// 100ms.
+	MaxBackoff time.Duration
+
+	// Rand, if non-nil, is the source of the backoff jitter, which makes the
+	// delays reproducible. It must not be shared by concurrent calls. Default
+	// is the global source of math/rand/v2.
+	Rand *rand.Rand
+}
+
+func (o *RetryOptions) withDefaults() RetryOptions {
+	var v RetryOptions
+	if o != nil {
+		v = *o
+	}
+	if v.MaxAttempts <= 0 {
+		v.MaxAttempts = 10
+	}
+	if v.InitialBackoff <= 0 {
+		v.InitialBackoff = time.Millisecond
+	}
+	if v.MaxBackoff <= 0 {
+		v.MaxBackoff = 100 * time.Millisecond
+	}
+	return v
+}
+
+// delay returns a random delay in (0, backoff].
+func (o *RetryOptions) delay(backoff time.Duration) time.Duration {
+	if o.Rand != nil {
+		return time.Duration(o.Rand.Int64N(int64(backoff))) + 1
+	}
+	return rand.N(backoff) + 1
+}
+
+// RunInTransaction runs fn in a new transaction and commits it. If fn or
+// Commit fails with a conflict, the whole attempt is retried in a new
+// transaction after a randomized exponential backoff, up to the maximum number
+// of attempts. Conflicts are errors that match ErrConflict or that the
+// ErrorClassifier of the context (see ContextWithErrorClassifier) classifies as
+// ClassConflict. A nil opts uses default options.
+//
+// Transactions are always rolled back when fn returns an error or panics; so
+// fn may be called multiple times, but only the side effects of the attempt
+// that committed are applied to the database. Side effects outside of the
+// transaction must be avoided in fn.
+//
+// Non-retryable errors from fn or Commit are returned as is. That includes
+// commits with an unknown outcome (see ErrUnknownOutcome), which may have
+// applied the transaction and must not be retried blindly. When the context
+// is canceled or all attempts fail, the returned error wraps both the reason
+// and the last error.
+func RunInTransaction(ctx context.Context, db kv.Database, fn func(context.Context, kv.Transaction) error, opts *RetryOptions) error {
+	o := opts.withDefaults()
+
+	var lastErr error
+	backoff := o.InitialBackoff
+	for attempt := 1; attempt <= o.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			timer := time.NewTimer(o.delay(backoff))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return fmt.Errorf("%w: %w", ctx.Err(), lastErr)
+			case <-timer.C:
+			}
+			backoff = min(2*backoff, o.MaxBackoff)
+		}
+		if err := ctx.Err(); err != nil {
+			if lastErr == nil {
+				return err
+			}
+			return fmt.Errorf("%w: %w", err, lastErr)
+		}
+
+		err := runAttempt(ctx, db, fn)
+		if err == nil {
+			return nil
+		}
+		if classify(ctx, err) != ClassConflict {
+			if ctx.Err() != nil && lastErr != nil {
+				// The attempt was cut short by the context, for example, in
+				// a remote NewTransaction call.
+				return fmt.Errorf("%w: %w", err, lastErr)
+			}
+			return err
+		}
+		lastErr = err
+	}
+	return fmt.Errorf("giving up after %d attempts: %w", o.MaxAttempts, lastErr)
+}
+
+// runAttempt runs fn in a single transaction, which is committed when fn
+// succeeds and rolled back otherwise.
+func runAttempt(ctx context.Context, db kv.Database, fn func(context.Context, kv.Transaction) error) error {
+	tx, err := db.NewTransaction(ctx)
+	if err != nil {
+		return err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			// Rollback errors are ignored in favor of the original failure. The
+			// rollback must reach remote databases even if ctx is done.
+			_ = tx.Rollback(context.WithoutCancel(ctx))
+		}
+	}()
+
+	if err := fn(ctx, tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
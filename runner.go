@@ -0,0 +1,153 @@
+package kvtests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/visvasity/kv"
+)
+
+// TestFunc is the signature shared by all database test cases in this package.
+type TestFunc func(ctx context.Context, t *testing.T, db kv.Database)
+
+// Case is a named database test case.
+type Case struct {
+	Name string
+	Func TestFunc
+}
+
+// Cases returns all database test cases in this package in a fixed order.
+func Cases() []Case {
+	return []Case{
+		{"TestEmptyKeyInvalid", TestEmptyKeyInvalid},
+		{"TestNilValueInvalid", TestNilValueInvalid},
+		{"TestNonExistentKey", TestNonExistentKey},
+		{"TestZeroLengthValue", TestZeroLengthValue},
+		{"TestLargeValueRoundtrip", TestLargeValueRoundtrip},
+		{"TestPrefixCleanupTrailingFF", TestPrefixCleanupTrailingFF},
+		{"TestRangeBeginEndInvalid", TestRangeBeginEndInvalid},
+		{"TestRangeBoundsInclusion", TestRangeBoundsInclusion},
+		{"TestRangeDescendBounds", TestRangeDescendBounds},
+		{"TestRangeFullDatabaseScan", TestRangeFullDatabaseScan},
+		{"TestTransactionVisibility", TestTransactionVisibility},
+		{"TestTransactionRollbackVisibility", TestTransactionRollbackVisibility},
+		{"TestTransactionDeleteVisibility", TestTransactionDeleteVisibility},
+		{"TestTransactionDeleteRecreate", TestTransactionDeleteRecreate},
+		{"TestCommitAfterRollbackIgnored", TestCommitAfterRollbackIgnored},
+		{"TestRollbackAfterCommitIgnored", TestRollbackAfterCommitIgnored},
+		{"TestDisjointTransactionCommit", TestDisjointTransactionCommit},
+		{"TestConflictingTransactionCommit", TestConflictingTransactionCommit},
+		{"TestFirstCommitterWins", TestFirstCommitterWins},
+		{"TestBlindWriteConflicts", TestBlindWriteConflicts},
+		{"TestLostUpdateInterleavings", TestLostUpdateInterleavings},
+		{"TestReadOnlyTransactionCommit", TestReadOnlyTransactionCommit},
+		{"TestSnapshotDoesNotBlockWriters", TestSnapshotDoesNotBlockWriters},
+		{"TestErrorClassification", TestErrorClassification},
+		{"TestRunInTransactionCounter", TestRunInTransactionCounter},
+		{"TestRunInTransactionRollback", TestRunInTransactionRollback},
+		{"TestRunInTransactionDeadline", TestRunInTransactionDeadline},
+		{"TestSnapshotIsolation", TestSnapshotIsolation},
+		{"TestSnapshotRepeatableRead", TestSnapshotRepeatableRead},
+		{"TestSnapshotFrozenAtCreation", TestSnapshotFrozenAtCreation},
+		{"TestSnapshotIteratorPrefixRange", TestSnapshotIteratorPrefixRange},
+		{"TestSnapshotIteratorStability", TestSnapshotIteratorStability},
+		{"TestSnapshotUnderChurn", TestSnapshotUnderChurn},
+		{"TestManySnapshots", TestManySnapshots},
+		{"TestDiscardedSnapshotBehavior", TestDiscardedSnapshotBehavior},
+		{"TestReopenCommittedVisible", TestReopenCommittedVisible},
+		{"TestReopenUncommittedInvisible", TestReopenUncommittedInvisible},
+		{"TestReopenOpenHandles", TestReopenOpenHandles},
+		{"TestCommitOutcomeUnderFaults", TestCommitOutcomeUnderFaults},
+		{"TestIteratorErrorUnderFaults", TestIteratorErrorUnderFaults},
+		{"TestCommitOutcomeAmbiguity", TestCommitOutcomeAmbiguity},
+	}
+}
+
+// Option configures the behavior of Run.
+type Option func(*runConfig)
+
+type runConfig struct {
+	leakCheck bool
+	caps      *Capabilities
+	classify  ErrorClassifier
+	expect    Expectations
+	seed      *uint64
+	delays    Delays
+}
+
+// WithLeakCheck makes Run fail every case that leaves goroutines or open file
+// descriptors behind. See LeakCheck for details.
+func WithLeakCheck() Option {
+	return func(c *runConfig) { c.leakCheck = true }
+}
+
+// WithCapabilities declares the capabilities of the database under test, for
+// databases that don't implement the CapabilityReporter interface.
+func WithCapabilities(caps Capabilities) Option {
+	return func(c *runConfig) { c.caps = &caps }
+}
+
+// WithErrorClassifier declares the error classes of the database under test,
+// for databases whose errors don't match the sentinel errors of Classify.
+func WithErrorClassifier(classifier ErrorClassifier) Option {
+	return func(c *runConfig) { c.classify = classifier }
+}
+
+// WithExpectations declares the known deviations of the database under test.
+// Run skips every case with an expectation and logs the reason. Since go test
+// can't report unexpected passes, use kvconform to find expected failures that
+// pass.
+func WithExpectations(exp Expectations) Option {
+	return func(c *runConfig) { c.expect = exp }
+}
+
+// WithSeed sets the seed for the randomness and scheduling jitter of all
+// cases, instead of the seed from the SeedEnv environment variable or a random
+// seed. A failing case logs the seed it was run with.
+func WithSeed(seed uint64) Option {
+	return func(c *runConfig) { c.seed = &seed }
+}
+
+// WithDelays makes Run inject latencies into the operations of every case (see
+// DelayDatabase), to rerun the cases under adversarial timing. The latencies
+// are sampled from the case seed, so a failing run can be replayed with the
+// same seed, though the exact goroutine interleaving may still differ.
+func WithDelays(delays Delays) Option {
+	return func(c *runConfig) { c.delays = delays }
+}
+
+// Run runs all database test cases against the database, each as a subtest of
+// t with the case name.
+func Run(ctx context.Context, t *testing.T, db kv.Database, opts ...Option) {
+	var cfg runConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.caps != nil {
+		ctx = ContextWithCapabilities(ctx, *cfg.caps)
+	}
+	if cfg.classify != nil {
+		ctx = ContextWithErrorClassifier(ctx, cfg.classify)
+	}
+	if cfg.seed != nil {
+		ctx = ContextWithSeed(ctx, *cfg.seed)
+	}
+
+	for _, c := range Cases() {
+		fn := c.Func
+		if cfg.leakCheck {
+			fn = LeakCheck(fn)
+		}
+		x, ok := cfg.expect[c.Name]
+		t.Run(c.Name, func(t *testing.T) {
+			if ok {
+				t.Skipf("skipped by expectations (%s): %s", x.Status, x.Reason)
+			}
+			db := db
+			if len(cfg.delays) > 0 {
+				db = DelayCaseDatabase(ctx, t, db, cfg.delays, c.Name)
+			}
+			fn(ctx, t, db)
+		})
+	}
+}
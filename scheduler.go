@@ -0,0 +1,433 @@
+package kvtests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/visvasity/kv"
+)
+
+// Program is one thread of a concurrent test program, usually a single
+// transaction. It must perform all database operations with the given context
+// and database, which let the scheduler control their order.
+type Program func(ctx context.Context, db kv.Database) error
+
+// Schedule is the order in which the database operations (steps) of a set of
+// programs ran, as the index of the program that ran each step.
+type Schedule []int
+
+func (s Schedule) String() string {
+	parts := make([]string, len(s))
+	for i, p := range s {
+		parts[i] = strconv.Itoa(p)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Exploration runs a small set of concurrent programs under many schedules,
+// like a stateless model checker. Every database operation of a program is a
+// step, which waits until the scheduler picks the program to run next, so
+// that every schedule is executed exactly instead of relying on sleeps.
+//
+// On databases with blocking conflicts (see Capabilities.BlockingConflicts),
+// operations that block inside the database (for example, on a lock held by
+// another program) are detected with a timeout that excludes the delays
+// injected by DelayDatabase, and the schedule continues with the other
+// programs. Schedules of such databases may not be exactly reproducible. On
+// other databases, every step is waited for.
+type Exploration struct {
+	// Name identifies the exploration in the derivation of the seed for random
+	// sampling from the run seed. Use a name derived from the test case, such
+	// as its key prefix, so that the same schedules are sampled whatever the
+	// name of the parent test is.
+	Name string
+
+	// Setup prepares the database before every schedule, for example by
+	// deleting and initializing the keys used by the programs.
+	Setup func(ctx context.Context, db kv.Database) error
+
+	// Programs are the concurrent programs; usually two or three.
+	Programs []Program
+
+	// Check verifies the state of the database and the errors returned by the
+	// programs after every schedule.
+	Check func(ctx context.Context, db kv.Database, errs []error) error
+
+	// Random samples random schedules, using the run seed (see SeedEnv),
+	// instead of enumerating all schedules in depth-first order.
+	Random bool
+
+	// MaxSchedules is the maximum number of schedules to run. Zero means all
+	// schedules for depth-first enumeration and 100 for random sampling.
+	MaxSchedules int
+}
+
+// Run explores the schedules of the programs against the database and fails
+// the test at the first schedule for which a program can't run or Check
+// fails, reporting the steps of the schedule. Returns the number of schedules
+// that were run.
+func (e *Exploration) Run(ctx context.Context, t testing.TB, db kv.Database) int {
+	t.Helper()
+
+	limit := e.MaxSchedules
+	var rnd *rand.Rand
+	if e.Random {
+		rnd = seededRand(caseSeed(ctx, t, e.Name), 0)
+		if limit == 0 {
+			limit = 100
+		}
+	}
+
+	var replay []int
+	for n := 1; limit == 0 || n <= limit; n++ {
+		if err := e.Setup(ctx, db); err != nil {
+			t.Fatalf("Setup for schedule %d: %v", n, err)
+		}
+
+		var decisions []schedDecision
+		choose := func(enabled []int) (int, error) {
+			d := schedDecision{enabled: enabled}
+			switch depth := len(decisions); {
+			case rnd != nil:
+				d.chosen = rnd.IntN(len(enabled))
+			case depth < len(replay):
+				if d.chosen = slices.Index(enabled, replay[depth]); d.chosen < 0 {
+					return 0, fmt.Errorf("step %d: program %d is not runnable in a replayed schedule (programs %v are); the database behaves nondeterministically", depth, replay[depth], enabled)
+				}
+			}
+			decisions = append(decisions, d)
+			return enabled[d.chosen], nil
+		}
+
+		sched, steps, errs, err := runSchedule(ctx, db, e.Programs, choose)
+		if err == nil {
+			err = e.Check(ctx, db, errs)
+		}
+		if err != nil {
+			t.Fatalf("Schedule %d [%v]: %v\nsteps:\n%s", n, sched, err, strings.Join(steps, "\n"))
+		}
+
+		if rnd == nil {
+			if replay = nextSchedule(decisions); replay == nil {
+				return n
+			}
+		}
+	}
+	return limit
+}
+
+// schedDecision records the programs that were runnable at a step and the
+// index of the chosen program.
+type schedDecision struct {
+	enabled []int
+	chosen  int
+}
+
+// nextSchedule returns the programs to choose at each step to run the next
+// schedule in depth-first order, or nil if all schedules were run.
+func nextSchedule(decisions []schedDecision) []int {
+	for d := len(decisions) - 1; d >= 0; d-- {
+		if decisions[d].chosen+1 < len(decisions[d].enabled) {
+			var replay []int
+			for _, x := range decisions[:d] {
+				replay = append(replay, x.enabled[x.chosen])
+			}
+			return append(replay, decisions[d].enabled[decisions[d].chosen+1])
+		}
+	}
+	return nil
+}
+
+// schedThread is the scheduler state of a single program.
+type schedThread struct {
+	id     int
+	wake   chan struct{}
+	events chan<- schedEvent
+	timer  blockTimer
+}
+
+type schedEvent struct {
+	id   int
+	done bool
+	op   string
+}
+
+type schedThreadKey struct{}
+
+// step waits until the scheduler picks the program running the operation. It
+// returns immediately if the context doesn't belong to a scheduled program.
+func step(ctx context.Context, op string) error {
+	th, ok := ctx.Value(schedThreadKey{}).(*schedThread)
+	if !ok {
+		return nil
+	}
+	select {
+	case th.events <- schedEvent{id: th.id, op: op}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-th.wake:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type threadState int
+
+const (
+	threadRunning threadState = iota
+	threadParked
+	threadDone
+)
+
+// runSchedule runs the programs concurrently, letting exactly one program run
+// a step at a time as chosen by the choose function among the runnable
+// programs. Returns the schedule, the description of every step and the
+// errors returned by the programs.
+func runSchedule(ctx context.Context, db kv.Database, programs []Program, choose func(enabled []int) (int, error)) (Schedule, []string, []error, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Steps of databases without blocking conflicts are waited for until they
+	// complete or a deadlock is reported.
+	blocking := capabilitiesOf(ctx, db).BlockingConflicts
+	blockWait := stepDeadlockWait
+	if blocking {
+		blockWait = stepBlockWait
+	}
+
+	sdb := &schedDatabase{db: db}
+	events := make(chan schedEvent)
+	threads := make([]*schedThread, len(programs))
+	state := make([]threadState, len(programs))
+	granted := make([]time.Time, len(programs))
+	limit := make([]time.Duration, len(programs)) // time given to the running step
+	ops := make([]string, len(programs))
+	errs := make([]error, len(programs))
+
+	for i, prog := range programs {
+		th := &schedThread{id: i, wake: make(chan struct{}, 1), events: events}
+		threads[i] = th
+		granted[i], limit[i] = time.Now(), blockWait
+		go func() {
+			errs[i] = prog(th.timer.context(context.WithValue(ctx, schedThreadKey{}, th)), sdb)
+			select {
+			case events <- schedEvent{id: i, done: true}:
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	apply := func(ev schedEvent) {
+		if ev.done {
+			state[ev.id] = threadDone
+		} else {
+			state[ev.id], ops[ev.id] = threadParked, ev.op
+		}
+	}
+
+	var sched Schedule
+	var steps []string
+	for {
+		// Wait until every running program parks at its next step, finishes or
+		// is considered blocked inside the database.
+		for {
+			wait := time.Duration(-1)
+			for i := range programs {
+				if state[i] != threadRunning {
+					continue
+				}
+				limit[i] += threads[i].timer.extend()
+				rem := limit[i] - time.Since(granted[i])
+				if rem <= 0 && !blocking {
+					return sched, steps, errs, fmt.Errorf("program %d did not complete its step in %v (deadlock?)", i, limit[i])
+				}
+				if rem > 0 && (wait < 0 || rem < wait) {
+					wait = rem
+				}
+			}
+			if wait < 0 {
+				break
+			}
+			select {
+			case ev := <-events:
+				apply(ev)
+			case <-time.After(wait):
+			}
+		}
+
+		var enabled, blocked []int
+		for i := range programs {
+			switch state[i] {
+			case threadParked:
+				enabled = append(enabled, i)
+			case threadRunning:
+				blocked = append(blocked, i)
+			}
+		}
+		if len(enabled) == 0 {
+			if len(blocked) == 0 {
+				return sched, steps, errs, nil
+			}
+			select {
+			case ev := <-events:
+				apply(ev)
+				continue
+			case <-time.After(stepDeadlockWait):
+				return sched, steps, errs, fmt.Errorf("programs %v did not complete their steps in %v (deadlock?)", blocked, stepDeadlockWait)
+			}
+		}
+
+		id, err := choose(enabled)
+		if err != nil {
+			return sched, steps, errs, err
+		}
+		sched = append(sched, id)
+		steps = append(steps, fmt.Sprintf("  %d: %s", id, ops[id]))
+		state[id], granted[id], limit[id] = threadRunning, time.Now(), blockWait
+		threads[id].timer.start()
+		threads[id].wake <- struct{}{}
+	}
+}
+
+// schedDatabase makes every operation on the database, its transactions and
+// its snapshots a step of the calling program, except for the Rollback of a
+// transaction after its Commit, which has no effect on other programs.
+type schedDatabase struct {
+	db kv.Database
+}
+
+// Unwrap returns the wrapped database.
+func (d *schedDatabase) Unwrap() kv.Database {
+	return d.db
+}
+
+func (d *schedDatabase) NewTransaction(ctx context.Context) (kv.Transaction, error) {
+	if err := step(ctx, "NewTransaction"); err != nil {
+		return nil, err
+	}
+	tx, err := d.db.NewTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &schedTransaction{Transaction: tx}, nil
+}
+
+func (d *schedDatabase) NewSnapshot(ctx context.Context) (kv.Snapshot, error) {
+	if err := step(ctx, "NewSnapshot"); err != nil {
+		return nil, err
+	}
+	snap, err := d.db.NewSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &schedSnapshot{Snapshot: snap}, nil
+}
+
+type schedTransaction struct {
+	kv.Transaction
+
+	committed bool // Commit was called
+}
+
+func (t *schedTransaction) Get(ctx context.Context, key string) (io.Reader, error) {
+	if err := step(ctx, fmt.Sprintf("Get(%q)", key)); err != nil {
+		return nil, err
+	}
+	return t.Transaction.Get(ctx, key)
+}
+
+func (t *schedTransaction) Set(ctx context.Context, key string, value io.Reader) error {
+	if err := step(ctx, fmt.Sprintf("Set(%q)", key)); err != nil {
+		return err
+	}
+	return t.Transaction.Set(ctx, key, value)
+}
+
+func (t *schedTransaction) Delete(ctx context.Context, key string) error {
+	if err := step(ctx, fmt.Sprintf("Delete(%q)", key)); err != nil {
+		return err
+	}
+	return t.Transaction.Delete(ctx, key)
+}
+
+func (t *schedTransaction) Ascend(ctx context.Context, beg, end string, errp *error) iter.Seq2[string, io.Reader] {
+	return schedSeq(ctx, fmt.Sprintf("Ascend(%q, %q)", beg, end), t.Transaction.Ascend(ctx, beg, end, errp), errp)
+}
+
+func (t *schedTransaction) Descend(ctx context.Context, beg, end string, errp *error) iter.Seq2[string, io.Reader] {
+	return schedSeq(ctx, fmt.Sprintf("Descend(%q, %q)", beg, end), t.Transaction.Descend(ctx, beg, end, errp), errp)
+}
+
+func (t *schedTransaction) Commit(ctx context.Context) error {
+	if err := step(ctx, "Commit"); err != nil {
+		return err
+	}
+	t.committed = true
+	return t.Transaction.Commit(ctx)
+}
+
+func (t *schedTransaction) Rollback(ctx context.Context) error {
+	if !t.committed {
+		if err := step(ctx, "Rollback"); err != nil {
+			return err
+		}
+	}
+	return t.Transaction.Rollback(ctx)
+}
+
+type schedSnapshot struct {
+	kv.Snapshot
+}
+
+func (s *schedSnapshot) Get(ctx context.Context, key string) (io.Reader, error) {
+	if err := step(ctx, fmt.Sprintf("Get(%q)", key)); err != nil {
+		return nil, err
+	}
+	return s.Snapshot.Get(ctx, key)
+}
+
+func (s *schedSnapshot) Ascend(ctx context.Context, beg, end string, errp *error) iter.Seq2[string, io.Reader] {
+	return schedSeq(ctx, fmt.Sprintf("Ascend(%q, %q)", beg, end), s.Snapshot.Ascend(ctx, beg, end, errp), errp)
+}
+
+func (s *schedSnapshot) Descend(ctx context.Context, beg, end string, errp *error) iter.Seq2[string, io.Reader] {
+	return schedSeq(ctx, fmt.Sprintf("Descend(%q, %q)", beg, end), s.Snapshot.Descend(ctx, beg, end, errp), errp)
+}
+
+func (s *schedSnapshot) Discard(ctx context.Context) error {
+	if err := step(ctx, "Discard"); err != nil {
+		return err
+	}
+	return s.Snapshot.Discard(ctx)
+}
+
+// schedSeq makes the start of the iteration and the fetching of every item
+// after the first a step of the calling program.
+func schedSeq(ctx context.Context, op string, seq iter.Seq2[string, io.Reader], errp *error) iter.Seq2[string, io.Reader] {
+	return func(yield func(string, io.Reader) bool) {
+		if err := step(ctx, op); err != nil {
+			*errp = err
+			return
+		}
+		for key, value := range seq {
+			if !yield(key, value) {
+				return
+			}
+			if err := step(ctx, op+" next"); err != nil {
+				*errp = err
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package kvtests
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// SeedEnv is the environment variable that sets the random seed of a test run
+// when no seed is given with WithSeed. Tests log the seed when they fail, so
+// that the failing case can be replayed by setting this variable.
+const SeedEnv = "KVTESTS_SEED"
+
+type seedKey struct{}
+
+// ContextWithSeed returns a context that sets the random seed for all test
+// cases run with it.
+func ContextWithSeed(ctx context.Context, seed uint64) context.Context {
+	return context.WithValue(ctx, seedKey{}, seed)
+}
+
+// defaultSeed is the seed used by all tests of a process that were not given a
+// seed by the context or the environment.
+var defaultSeed = sync.OnceValue(rand.Uint64)
+
+// ParseSeed parses a seed in the format used by SeedEnv.
+func ParseSeed(s string) (uint64, error) {
+	seed, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid seed %q: %w", s, os.ErrInvalid)
+	}
+	return seed, nil
+}
+
+// runSeed returns the seed set by the context, or else by the environment, or
+// else a random seed that is the same for the whole process.
+func runSeed(ctx context.Context) (uint64, error) {
+	if seed, ok := ctx.Value(seedKey{}).(uint64); ok {
+		return seed, nil
+	}
+	if s := os.Getenv(SeedEnv); s != "" {
+		return ParseSeed(s)
+	}
+	return defaultSeed(), nil
+}
+
+// caseSeed returns the seed for all randomness of the named test case, which
+// is derived from the run seed, and logs the run seed if the test fails.
+func caseSeed(ctx context.Context, t testing.TB, name string) uint64 {
+	t.Helper()
+
+	seed, err := runSeed(ctx)
+	if err != nil {
+		t.Fatalf("%s: %v", SeedEnv, err)
+	}
+	t.Cleanup(func() {
+		if t.Failed() {
+			t.Logf("random seed is %d; set %s=%d to replay", seed, SeedEnv, seed)
+		}
+	})
+
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return seed ^ h.Sum64()
+}
+
+// seededRand returns a random number generator for one of the independent
+// streams of the seed, such as one per goroutine.
+func seededRand(seed uint64, stream int) *rand.Rand {
+	return rand.New(rand.NewPCG(seed, uint64(stream)))
+}
+
+// jitter sleeps for a random duration below limit to vary the scheduling of
+// concurrent operations in a reproducible way. The duration may be zero.
+func jitter(rnd *rand.Rand, limit time.Duration) {
+	time.Sleep(time.Duration(rnd.Int64N(int64(limit))))
+}
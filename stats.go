@@ -0,0 +1,24 @@
+package kvtests
+
+import "context"
+
+// StorageStats describes the storage used by a database.
+type StorageStats struct {
+	// Keys is the number of live keys.
+	Keys int64 `json:"keys"`
+
+	// Versions is the number of stored key versions, including overwritten and
+	// deleted versions that are not garbage collected yet.
+	Versions int64 `json:"versions"`
+
+	// Bytes is the storage used by keys and values in bytes, or zero if it is
+	// unknown.
+	Bytes int64 `json:"bytes"`
+}
+
+// StatsReporter is an optional interface for kv.Database implementations that
+// can report storage statistics. Tests use it to verify garbage collection of
+// old versions.
+type StatsReporter interface {
+	StorageStats(ctx context.Context) (StorageStats, error)
+}
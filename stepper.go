@@ -0,0 +1,224 @@
+package kvtests
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/visvasity/kv"
+)
+
+// stepBlockWait is how long a step of a database with blocking conflicts (see
+// Capabilities.BlockingConflicts) is given to complete before it is considered
+// blocked (for example, on a row lock held by another transaction) and the
+// test moves on to the next step in its schedule. Delays injected by
+// DelayDatabase don't count towards it.
+const stepBlockWait = 100 * time.Millisecond
+
+// stepDeadlockWait is how long a step, or wait for the outstanding steps of a
+// transaction, waits before the test is failed.
+const stepDeadlockWait = 10 * time.Second
+
+// blockTimer detects steps that are blocked inside a database with blocking
+// conflicts. Delays injected by DelayDatabase into the operations of a step
+// extend the time the step is given.
+type blockTimer struct {
+	injected atomic.Int64 // nanoseconds of injected delays not yet accounted
+}
+
+// context returns a context that reports the injected delays of the operations
+// with the context to the timer.
+func (b *blockTimer) context(ctx context.Context) context.Context {
+	return withDelayObserver(ctx, func(d time.Duration) { b.injected.Add(int64(d)) })
+}
+
+// start starts timing a new step.
+func (b *blockTimer) start() {
+	b.injected.Store(0)
+}
+
+// extend returns the injected delays since the last call, which extend the
+// time the step is given.
+func (b *blockTimer) extend() time.Duration {
+	return time.Duration(b.injected.Swap(0))
+}
+
+// txnStepper runs the operations of a single transaction, one step at a time,
+// in its own goroutine. Tests use it to execute a fixed interleaving of
+// operations from multiple transactions without deadlocking on databases
+// where an operation can block until another transaction finishes.
+type txnStepper struct {
+	t    testing.TB
+	name string
+
+	blocking bool // database has blocking conflicts
+	timer    blockTimer
+
+	steps   chan txnStep
+	pending []chan error
+	blocked bool
+	closed  bool
+
+	err error // first error from any step
+}
+
+type txnStep struct {
+	fn   func(context.Context, kv.Transaction) error
+	done chan error
+}
+
+// newTxnStepper begins a new transaction in its own goroutine.
+func newTxnStepper(ctx context.Context, t testing.TB, db kv.Database, name string) *txnStepper {
+	s := &txnStepper{
+		t:        t,
+		name:     name,
+		blocking: capabilitiesOf(ctx, db).BlockingConflicts,
+		steps:    make(chan txnStep, 16),
+	}
+	ready := make(chan error, 1)
+	go s.loop(ctx, db, ready)
+	if err := <-ready; err != nil {
+		t.Fatalf("%s: NewTransaction: %v", name, err)
+	}
+	t.Cleanup(func() {
+		if !s.closed {
+			close(s.steps)
+		}
+	})
+	return s
+}
+
+func (s *txnStepper) loop(ctx context.Context, db kv.Database, ready chan<- error) {
+	ctx = s.timer.context(ctx)
+	tx, err := db.NewTransaction(ctx)
+	ready <- err
+	if err != nil {
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var first error
+	for step := range s.steps {
+		if first != nil {
+			step.done <- first
+			continue
+		}
+		if err := step.fn(ctx, tx); err != nil {
+			first = err
+		}
+		step.done <- first
+	}
+}
+
+// do runs a step of the transaction and waits for it to complete. On databases
+// with blocking conflicts, returns false if the step didn't complete within
+// stepBlockWait; such steps, and the steps after them, are waited for by
+// settle or wait. Steps after the first failed step are not executed.
+func (s *txnStepper) do(fn func(context.Context, kv.Transaction) error) bool {
+	s.t.Helper()
+
+	step := txnStep{fn: fn, done: make(chan error, 1)}
+	if len(s.pending) == 0 {
+		s.timer.start()
+	}
+	s.steps <- step
+
+	if len(s.pending) == 0 {
+		limit := stepDeadlockWait
+		if s.blocking {
+			limit = stepBlockWait
+		}
+		timer := time.NewTimer(limit)
+		defer timer.Stop()
+		for {
+			select {
+			case err := <-step.done:
+				s.record(err)
+				return true
+			case <-timer.C:
+			}
+			if d := s.timer.extend(); d > 0 {
+				timer.Reset(d)
+				continue
+			}
+			if !s.blocking {
+				s.t.Fatalf("%s: operation did not complete in %v (deadlock?)", s.name, stepDeadlockWait)
+			}
+			break
+		}
+	}
+	s.blocked = true
+	s.pending = append(s.pending, step.done)
+	return false
+}
+
+func (s *txnStepper) record(err error) {
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+}
+
+// get reads the key in the transaction.
+func (s *txnStepper) get(ctx context.Context, key string) bool {
+	return s.do(func(ctx context.Context, tx kv.Transaction) error {
+		_, err := tx.Get(ctx, key)
+		return err
+	})
+}
+
+// set writes the key in the transaction.
+func (s *txnStepper) set(ctx context.Context, key, value string) bool {
+	return s.do(func(ctx context.Context, tx kv.Transaction) error {
+		return tx.Set(ctx, key, strings.NewReader(value))
+	})
+}
+
+// del deletes the key in the transaction. Deleting a non-existent key is not
+// considered a failure.
+func (s *txnStepper) del(ctx context.Context, key string) bool {
+	return s.do(func(ctx context.Context, tx kv.Transaction) error {
+		if err := tx.Delete(ctx, key); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	})
+}
+
+// commit commits the transaction.
+func (s *txnStepper) commit(ctx context.Context) bool {
+	return s.do(func(ctx context.Context, tx kv.Transaction) error {
+		return tx.Commit(ctx)
+	})
+}
+
+// settle waits for all outstanding steps, so that the transaction doesn't
+// overlap with the steps of other transactions that follow.
+func (s *txnStepper) settle() {
+	s.t.Helper()
+
+	timeout := time.After(stepDeadlockWait)
+	for _, done := range s.pending {
+		select {
+		case err := <-done:
+			s.record(err)
+		case <-timeout:
+			s.t.Fatalf("%s: operations did not complete in %v (deadlock?)", s.name, stepDeadlockWait)
+		}
+	}
+	s.pending = nil
+}
+
+// wait waits for all outstanding steps, finishes the transaction goroutine and
+// returns the first error from any step. Must be called exactly once.
+func (s *txnStepper) wait() error {
+	s.t.Helper()
+
+	s.settle()
+	s.closed = true
+	close(s.steps)
+	return s.err
+}
@@ -0,0 +1,134 @@
+package kvtests
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/visvasity/kv"
+)
+
+// TestBlindWriteConflicts pins the behavior of two concurrent transactions A
+// and B that write the same key without reading it. A commits before B.
+//
+// If the database declares Capabilities.BlindWritesConflict, B must fail with
+// a conflict error and A's write must win. Otherwise, both must commit and B's
+// write must win. Deleting a non-existent key from both transactions leaves
+// the key absent either way; only conflict errors are allowed there.
+func TestBlindWriteConflicts(ctx context.Context, t *testing.T, db kv.Database) {
+	const prefix = "/TestBlindWriteConflicts/"
+
+	cleanupPrefix(ctx, t, db, prefix)
+	defer cleanupPrefix(ctx, t, db, prefix)
+
+	const key = prefix + "key"
+
+	caps := capabilitiesOf(ctx, db)
+	t.Logf("Database declares BlindWritesConflict=%t", caps.BlindWritesConflict)
+
+	tests := []struct {
+		name    string
+		initial string // empty if the key doesn't exist initially
+		a, b    string // value to write; empty to delete
+	}{
+		{name: "set/set existing", initial: "initial", a: "A", b: "B"},
+		{name: "set/set new", a: "A", b: "B"},
+		{name: "delete/delete non-existent"},
+		{name: "delete/delete existing", initial: "initial"},
+		{name: "delete/set", initial: "initial", b: "B"},
+		{name: "set/delete", initial: "initial", a: "A"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tx, err := db.NewTransaction(ctx)
+			if err != nil {
+				t.Fatalf("NewTransaction (reset): %v", err)
+			}
+			if tc.initial == "" {
+				err = tx.Delete(ctx, key)
+				if errors.Is(err, os.ErrNotExist) {
+					err = nil
+				}
+			} else {
+				err = tx.Set(ctx, key, strings.NewReader(tc.initial))
+			}
+			if err != nil {
+				t.Fatalf("Reset: %v", err)
+			}
+			if err := tx.Commit(ctx); err != nil {
+				t.Fatalf("Commit (reset): %v", err)
+			}
+
+			write := func(s *txnStepper, value string) {
+				if value == "" {
+					s.del(ctx, key)
+				} else {
+					s.set(ctx, key, value)
+				}
+			}
+
+			a := newTxnStepper(ctx, t, db, "A")
+			b := newTxnStepper(ctx, t, db, "B")
+			write(a, tc.a)
+			write(b, tc.b)
+			a.commit(ctx)
+			b.commit(ctx)
+			aerr, berr := a.wait(), b.wait()
+			blocked := a.blocked || b.blocked
+
+			// want is the expected final value; empty means the key must not exist
+			var want string
+			switch {
+			case tc.initial == "" && tc.a == "" && tc.b == "":
+				// Neither write changes anything; a conflict is allowed but
+				// not required.
+				for name, err := range map[string]error{"A": aerr, "B": berr} {
+					if err != nil && classify(ctx, err) != ClassConflict {
+						t.Errorf("Transaction %s failed with error class %v (%v); want none or %v", name, classify(ctx, err), err, ClassConflict)
+					}
+				}
+			case caps.BlindWritesConflict:
+				winner, loser, werr, lerr := "A", "B", aerr, berr
+				want = tc.a
+				if blocked && aerr != nil {
+					// Lock order decided the winner.
+					winner, loser, werr, lerr = "B", "A", berr, aerr
+					want = tc.b
+				}
+				if werr != nil {
+					t.Errorf("Transaction %s (first committer) failed: %v", winner, werr)
+				}
+				if lerr == nil {
+					t.Errorf("Transaction %s (second committer) committed a conflicting blind write; want a conflict", loser)
+				} else if classify(ctx, lerr) != ClassConflict {
+					t.Errorf("Transaction %s (second committer) failed with error class %v (%v); want %v", loser, classify(ctx, lerr), lerr, ClassConflict)
+				}
+			default:
+				if aerr != nil {
+					t.Errorf("Transaction A failed: %v; blind writes must not conflict", aerr)
+				}
+				if berr != nil {
+					t.Errorf("Transaction B failed: %v; blind writes must not conflict", berr)
+				}
+				want = tc.b
+			}
+
+			snap, err := db.NewSnapshot(ctx)
+			if err != nil {
+				t.Fatalf("NewSnapshot: %v", err)
+			}
+			defer snap.Discard(ctx)
+
+			if want == "" {
+				if _, err := snap.Get(ctx, key); !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("Get(%q) = %v; want os.ErrNotExist", key, err)
+				}
+			} else if err := checkValue(ctx, snap, key, want); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package kvtests
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/visvasity/kv"
+	"github.com/visvasity/kvtests/faultproxy"
+)
+
+// faultSettleWait is how long delayed requests are given to reach the server
+// after a fault is cleared.
+const faultSettleWait = 100 * time.Millisecond
+
+// TestCommitOutcomeAmbiguity verifies that a Commit that fails because of a
+// transport failure does not leave the caller guessing: the transaction must
+// not be applied, not even by a delayed commit request, unless the error
+// matches ErrUnknownOutcome. Faults hit the Commit request, part of the Commit
+// request, or its response, where the transaction is applied on the server but
+// the client doesn't learn about it.
+//
+// The test is skipped if the database doesn't implement the FaultProxied
+// interface.
+func TestCommitOutcomeAmbiguity(ctx context.Context, t *testing.T, db kv.Database) {
+	p := faultProxy(t, db)
+
+	const prefix = "/TestCommitOutcomeAmbiguity/"
+
+	cleanupPrefix(ctx, t, db, prefix)
+	defer cleanupPrefix(ctx, t, db, prefix)
+
+	var faults []faultproxy.Fault
+	for _, kind := range []faultproxy.Kind{faultproxy.Drop, faultproxy.Stall, faultproxy.Reset} {
+		faults = append(faults,
+			faultproxy.Fault{Kind: kind, Direction: faultproxy.ToServer},
+			faultproxy.Fault{Kind: kind, Direction: faultproxy.ToServer, After: 16},
+			faultproxy.Fault{Kind: kind, Direction: faultproxy.ToClient})
+	}
+
+	unknown := 0
+	for i, f := range faults {
+		t.Run(fmt.Sprintf("%s-%s-%d", f.Kind, f.Direction, f.After), func(t *testing.T) {
+			key := fmt.Sprintf("%skey-%02d", prefix, i)
+
+			tx, err := db.NewTransaction(ctx)
+			if err != nil {
+				t.Fatalf("NewTransaction: %v", err)
+			}
+			// The transaction is rolled back only after the outcome is
+			// checked, because a rollback could mask a delayed commit.
+			defer tx.Rollback(ctx)
+
+			if err := tx.Set(ctx, key, strings.NewReader("committed")); err != nil {
+				t.Fatalf("Set %q: %v", key, err)
+			}
+
+			cctx, cancel := context.WithTimeout(ctx, faultTimeout)
+			hit := p.Inject(f)
+			commitErr := tx.Commit(cctx)
+			cancel()
+			p.Clear()
+
+			select {
+			case <-hit:
+			default:
+				t.Fatalf("Commit did not send or receive enough data through the fault proxy")
+			}
+			time.Sleep(faultSettleWait)
+
+			value, applied := readAfterFault(ctx, t, db, key)
+			if applied && value != "committed" {
+				t.Errorf("Key %q has value %q after Commit under fault %v; want %q", key, value, f, "committed")
+			}
+			switch {
+			case commitErr == nil && !applied:
+				t.Errorf("Commit under fault %v returned nil, but the transaction was not applied", f)
+			case commitErr == nil:
+			case classify(ctx, commitErr) == ClassUnknownOutcome:
+				unknown++
+				t.Logf("Commit under fault %v has an unknown outcome (applied=%t): %v", f, applied, commitErr)
+			case applied:
+				t.Errorf("Commit under fault %v failed with %v (class %s), but the transaction was applied; a Commit that may have been applied must return an error matching ErrUnknownOutcome", f, commitErr, classify(ctx, commitErr))
+			default:
+				t.Logf("Commit under fault %v failed and was not applied: %v", f, commitErr)
+			}
+		})
+	}
+	t.Logf("%d of %d faults left the commit outcome unknown", unknown, len(faults))
+}
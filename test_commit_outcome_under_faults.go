@@ -0,0 +1,72 @@
+package kvtests
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/visvasity/kv"
+	"github.com/visvasity/kvtests/faultproxy"
+)
+
+// TestCommitOutcomeUnderFaults verifies that the outcome of a Commit is well
+// defined when the connection to a remote database is dropped, stalled or
+// reset during the Commit: a Commit that returns nil must have applied the
+// transaction, so that no successful commit is silently lost. Faults hit
+// either the Commit request or its response.
+//
+// The test is skipped if the database doesn't implement the FaultProxied
+// interface.
+func TestCommitOutcomeUnderFaults(ctx context.Context, t *testing.T, db kv.Database) {
+	p := faultProxy(t, db)
+
+	const prefix = "/TestCommitOutcomeUnderFaults/"
+
+	cleanupPrefix(ctx, t, db, prefix)
+	defer cleanupPrefix(ctx, t, db, prefix)
+
+	for _, dir := range []faultproxy.Direction{faultproxy.ToServer, faultproxy.ToClient} {
+		for _, kind := range []faultproxy.Kind{faultproxy.Drop, faultproxy.Stall, faultproxy.Reset} {
+			f := faultproxy.Fault{Kind: kind, Direction: dir}
+			t.Run(fmt.Sprintf("%s-%s", kind, dir), func(t *testing.T) {
+				key := fmt.Sprintf("%s%s-%s", prefix, kind, dir)
+
+				tx, err := db.NewTransaction(ctx)
+				if err != nil {
+					t.Fatalf("NewTransaction: %v", err)
+				}
+				if err := tx.Set(ctx, key, strings.NewReader("committed")); err != nil {
+					t.Fatalf("Set %q: %v", key, err)
+				}
+
+				cctx, cancel := context.WithTimeout(ctx, faultTimeout)
+				hit := p.Inject(f)
+				commitErr := tx.Commit(cctx)
+				cancel()
+				p.Clear()
+
+				select {
+				case <-hit:
+				default:
+					t.Fatalf("Commit did not send or receive any data through the fault proxy")
+				}
+				if commitErr != nil {
+					// Release the transaction if the Commit never reached the
+					// server.
+					tx.Rollback(ctx)
+				}
+
+				value, ok := readAfterFault(ctx, t, db, key)
+				switch {
+				case commitErr == nil && !ok:
+					t.Errorf("Commit under fault %v returned nil, but the transaction is lost", f)
+				case ok && value != "committed":
+					t.Errorf("Key %q has value %q after Commit under fault %v; want %q", key, value, f, "committed")
+				case commitErr != nil:
+					t.Logf("Commit under fault %v failed (applied=%t): %v", f, ok, commitErr)
+				}
+			})
+		}
+	}
+}
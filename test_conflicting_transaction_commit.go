@@ -7,6 +7,7 @@ import (
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/visvasity/kv"
 )
@@ -14,7 +15,10 @@ import (
 // TestConflictingTransactionCommit verifies correct conflict detection:
 // When multiple transactions concurrently modify the same key,
 // only non-conflicting ones commit. At least one must succeed,
+// every failure must be classified as a conflict (see ErrorClassifier),
 // and the final value must be from one of the successful commits.
+// Every transaction sleeps for a random, seeded jitter between its operations
+// (see SeedEnv).
 func TestConflictingTransactionCommit(ctx context.Context, t *testing.T, db kv.Database) {
 	const prefix = "/TestConflictingTransactionCommit/"
 	cleanupPrefix(ctx, t, db, prefix)
@@ -23,11 +27,14 @@ func TestConflictingTransactionCommit(ctx context.Context, t *testing.T, db kv.D
 	const key = prefix + "hotspot"
 	const numTxns = 100
 
+	seed := caseSeed(ctx, t, prefix)
+
 	var commitCount atomic.Int32
 	var wg sync.WaitGroup
 
 	for i := 0; i < numTxns; i++ {
 		wg.Add(1)
+		rnd := seededRand(seed, i)
 		go func() {
 			defer wg.Done()
 
@@ -38,17 +45,26 @@ func TestConflictingTransactionCommit(ctx context.Context, t *testing.T, db kv.D
 			}
 
 			// Read-modify-write: read current value (may be nil), then write
+			jitter(rnd, time.Millisecond)
 			_, _ = tx.Get(ctx, key) // ignore error — may not exist
 
+			jitter(rnd, time.Millisecond)
 			if err := tx.Set(ctx, key, strings.NewReader("winner")); err != nil {
 				tx.Rollback(ctx)
+				if c := classify(ctx, err); c != ClassConflict {
+					t.Errorf("Set failed with error class %v (%v); want %v", c, err, ClassConflict)
+				}
 				return
 			}
 
+			jitter(rnd, time.Millisecond)
 			if err := tx.Commit(ctx); err == nil {
 				commitCount.Add(1)
+			} else if c := classify(ctx, err); c != ClassConflict {
+				// Only conflicts are expected; closed or invalid transactions
+				// and unclassified errors are real failures
+				t.Errorf("Commit failed with error class %v (%v); want %v", c, err, ClassConflict)
 			}
-			// else: conflict → expected, ignored
 			tx.Rollback(ctx) // safe after commit
 		}()
 	}
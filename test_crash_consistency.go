@@ -0,0 +1,260 @@
+package kvtests
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/visvasity/kv"
+)
+
+// Opener opens a file-backed database stored in the given directory. If the
+// returned database also implements io.Closer, it is closed when it is no
+// longer needed.
+type Opener func(ctx context.Context, dir string) (kv.Database, error)
+
+const (
+	crashDirEnv   = "KVTESTS_CRASH_DIR"
+	crashTestEnv  = "KVTESTS_CRASH_TEST"
+	crashStartEnv = "KVTESTS_CRASH_START"
+
+	crashReadyMarker  = "kvtests-crash-ready"
+	crashCommitMarker = "kvtests-crash-committed "
+	crashKeysPerTxn   = 8
+)
+
+// TestCrashConsistency verifies atomicity and durability of a file-backed
+// database across process crashes. It repeatedly re-executes the current test
+// binary to run a write workload in a child process, kills the child with
+// SIGKILL at a random point, reopens the store and verifies that every
+// transaction is either fully present or fully absent, and that every
+// transaction reported as committed by the child is present. The kill delays
+// are derived from the run seed (see SeedEnv).
+//
+// TestCrashConsistency must be called directly from a top-level test function
+// in a go test binary, because the child process re-runs the same test (by
+// name) to act as the writer.
+func TestCrashConsistency(ctx context.Context, t *testing.T, open Opener) {
+	if os.Getenv(crashTestEnv) == t.Name() {
+		crashChild(ctx, t, open, os.Getenv(crashDirEnv))
+		return
+	}
+
+	const prefix = "/TestCrashConsistency/"
+
+	rounds := 20
+	if testing.Short() {
+		rounds = 5
+	}
+
+	rnd := seededRand(caseSeed(ctx, t, prefix), 0)
+
+	dir := t.TempDir()
+	next := 0
+	for round := 0; round < rounds; round++ {
+		delay := time.Duration(rnd.Int64N(int64(100 * time.Millisecond)))
+
+		committed, output := crashRound(ctx, t, dir, next, delay)
+		t.Logf("round %d: killed writer after %v; %d transactions were reported committed", round, delay, len(committed))
+
+		last := crashVerify(ctx, t, open, dir, prefix, committed)
+		if t.Failed() {
+			t.Logf("writer output:\n%s", output)
+			return
+		}
+		next = last + 1
+	}
+	if next == 0 {
+		t.Errorf("No transaction survived any of the %d crashes; writer may not be making progress", rounds)
+	}
+}
+
+// crashRound runs the writer in a child process starting at transaction id
+// start, kills it when delay has passed since the writer became ready and
+// returns the ids reported as committed along with the child's output.
+func crashRound(ctx context.Context, t *testing.T, dir string, start int, delay time.Duration) ([]int, []byte) {
+	t.Helper()
+
+	cmd := exec.CommandContext(ctx, os.Args[0], "-test.run="+exactTestPattern(t.Name()), "-test.count=1", "-test.timeout=0")
+	cmd.Env = append(os.Environ(),
+		crashTestEnv+"="+t.Name(),
+		crashDirEnv+"="+dir,
+		crashStartEnv+"="+strconv.Itoa(start))
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("StdoutPipe: %v", err)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("could not start writer process: %v", err)
+	}
+
+	var output bytes.Buffer
+	var committed []int
+	var wg sync.WaitGroup
+	ready := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s := bufio.NewScanner(stdout)
+		for s.Scan() {
+			line := s.Text()
+			if line == crashReadyMarker {
+				close(ready)
+				continue
+			}
+			if v, ok := strings.CutPrefix(line, crashCommitMarker); ok {
+				if id, err := strconv.Atoi(v); err == nil {
+					committed = append(committed, id)
+					continue
+				}
+			}
+			fmt.Fprintln(&output, line)
+		}
+	}()
+
+	exited := make(chan error, 1)
+	go func() {
+		wg.Wait()
+		exited <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-exited:
+		t.Fatalf("writer process exited before it was ready (%v); output:\n%s%s", err, output.Bytes(), stderr.Bytes())
+	case <-ready:
+	}
+
+	select {
+	case err := <-exited:
+		t.Fatalf("writer process exited before it was killed (%v); output:\n%s%s", err, output.Bytes(), stderr.Bytes())
+	case <-time.After(delay):
+	}
+
+	if err := cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		t.Fatalf("could not kill writer process: %v", err)
+	}
+	<-exited
+	return committed, append(output.Bytes(), stderr.Bytes()...)
+}
+
+// crashVerify opens the database and checks that all transactions are either
+// fully present or fully absent and that all committed ids are present. It
+// returns the largest transaction id found in the database or -1.
+func crashVerify(ctx context.Context, t *testing.T, open Opener, dir, prefix string, committed []int) int {
+	t.Helper()
+
+	db, err := open(ctx, dir)
+	if err != nil {
+		t.Fatalf("could not reopen database after crash: %v", err)
+	}
+	if c, ok := db.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	snap, err := db.NewSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("NewSnapshot after crash: %v", err)
+	}
+	defer snap.Discard(ctx)
+
+	counts := make(map[int]int)
+	last := -1
+	var iterErr error
+	for key, val := range snap.Ascend(ctx, prefix+"txn/", prefix+"txn0", &iterErr) {
+		id, err := strconv.Atoi(strings.SplitN(strings.TrimPrefix(key, prefix+"txn/"), "/", 2)[0])
+		if err != nil {
+			t.Errorf("Unexpected key %q after crash", key)
+			continue
+		}
+		if err := checkReader(key, val, strconv.Itoa(id)); err != nil {
+			t.Errorf("After crash: %v", err)
+		}
+		counts[id]++
+		last = max(last, id)
+	}
+	if iterErr != nil {
+		t.Fatalf("Ascend after crash: %v", iterErr)
+	}
+
+	// Transactions are committed one after another, so all transactions up to
+	// the last one must be present in full.
+	for id := 0; id <= last; id++ {
+		if n := counts[id]; n != crashKeysPerTxn {
+			t.Errorf("Transaction %d has %d of %d keys after crash (atomicity violated)", id, n, crashKeysPerTxn)
+		}
+	}
+	for _, id := range committed {
+		if id > last {
+			t.Errorf("Transaction %d was committed successfully but is lost after crash (durability violated)", id)
+		}
+	}
+
+	if last >= 0 {
+		if err := checkValue(ctx, snap, prefix+"latest", strconv.Itoa(last)); err != nil {
+			t.Errorf("After crash: %v", err)
+		}
+	}
+	return last
+}
+
+// crashChild is the writer workload run in the child process. It commits
+// transactions with increasing ids until it is killed.
+func crashChild(ctx context.Context, t *testing.T, open Opener, dir string) {
+	const prefix = "/TestCrashConsistency/"
+
+	start, err := strconv.Atoi(os.Getenv(crashStartEnv))
+	if err != nil {
+		t.Fatalf("invalid %s value: %v", crashStartEnv, err)
+	}
+
+	db, err := open(ctx, dir)
+	if err != nil {
+		t.Fatalf("could not open database in writer process: %v", err)
+	}
+	fmt.Println(crashReadyMarker)
+
+	for id := start; ; id++ {
+		tx, err := db.NewTransaction(ctx)
+		if err != nil {
+			t.Fatalf("NewTransaction (txn %d): %v", id, err)
+		}
+		value := strconv.Itoa(id)
+		for j := 0; j < crashKeysPerTxn; j++ {
+			key := fmt.Sprintf("%stxn/%08d/%02d", prefix, id, j)
+			if err := tx.Set(ctx, key, strings.NewReader(value)); err != nil {
+				t.Fatalf("Set %q: %v", key, err)
+			}
+		}
+		if err := tx.Set(ctx, prefix+"latest", strings.NewReader(value)); err != nil {
+			t.Fatalf("Set latest: %v", err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			t.Fatalf("Commit (txn %d): %v", id, err)
+		}
+		fmt.Printf("%s%d\n", crashCommitMarker, id)
+	}
+}
+
+// exactTestPattern returns a -test.run pattern that matches only the test
+// with the given (possibly nested) name.
+func exactTestPattern(name string) string {
+	parts := strings.Split(name, "/")
+	for i, p := range parts {
+		parts[i] = "^" + regexp.QuoteMeta(p) + "$"
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,172 @@
+package kvtests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/visvasity/kv"
+	"github.com/visvasity/kvmemdb"
+)
+
+// fileDB is a file-backed database for tests: a kvmemdb whose committed
+// transactions are appended to a log file and replayed when it is opened.
+// Commits are durable across process crashes, but not across operating system
+// crashes, since the log is not synced.
+type fileDB struct {
+	kv.Database
+
+	mu  sync.Mutex // serializes commits with their log records
+	log *os.File
+}
+
+// fileOp is a write of a committed transaction in the log. Every transaction
+// is a single line of JSON, so a torn record is an incomplete last line.
+type fileOp struct {
+	Key    string `json:"key"`
+	Value  []byte `json:"value,omitempty"`
+	Delete bool   `json:"delete,omitempty"`
+}
+
+// openFileDB opens the database stored in the directory. It is an Opener.
+func openFileDB(ctx context.Context, dir string) (kv.Database, error) {
+	f, err := os.OpenFile(filepath.Join(dir, "log"), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	db := kv.DatabaseFrom(kvmemdb.New())
+	tx, err := db.NewTransaction(ctx)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Transactions are replayed in log order in a single transaction.
+	valid := 0
+	for {
+		line, rest, ok := bytes.Cut(data[valid:], []byte("\n"))
+		if !ok {
+			break
+		}
+		var ops []fileOp
+		if err := json.Unmarshal(line, &ops); err != nil {
+			f.Close()
+			return nil, err
+		}
+		if err := replay(ctx, tx, ops); err != nil {
+			f.Close()
+			return nil, err
+		}
+		valid = len(data) - len(rest)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// Drop a torn record, so that new records are appended after the last
+	// complete one.
+	if err := f.Truncate(int64(valid)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(int64(valid), io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileDB{Database: db, log: f}, nil
+}
+
+// replay applies the writes of a committed transaction.
+func replay(ctx context.Context, tx kv.Transaction, ops []fileOp) error {
+	for _, op := range ops {
+		var err error
+		if op.Delete {
+			err = tx.Delete(ctx, op.Key)
+		} else {
+			err = tx.Set(ctx, op.Key, bytes.NewReader(op.Value))
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *fileDB) Close() error {
+	return d.log.Close()
+}
+
+func (d *fileDB) NewTransaction(ctx context.Context) (kv.Transaction, error) {
+	tx, err := d.Database.NewTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &fileTx{Transaction: tx, db: d}, nil
+}
+
+// fileTx records the writes of a transaction for the log.
+type fileTx struct {
+	kv.Transaction
+
+	db  *fileDB
+	ops []fileOp
+}
+
+func (t *fileTx) Set(ctx context.Context, key string, value io.Reader) error {
+	if value == nil {
+		return t.Transaction.Set(ctx, key, value)
+	}
+	data, err := io.ReadAll(value)
+	if err != nil {
+		return err
+	}
+	if err := t.Transaction.Set(ctx, key, bytes.NewReader(data)); err != nil {
+		return err
+	}
+	t.ops = append(t.ops, fileOp{Key: key, Value: data})
+	return nil
+}
+
+func (t *fileTx) Delete(ctx context.Context, key string) error {
+	if err := t.Transaction.Delete(ctx, key); err != nil {
+		return err
+	}
+	t.ops = append(t.ops, fileOp{Key: key, Delete: true})
+	return nil
+}
+
+func (t *fileTx) Commit(ctx context.Context) error {
+	t.db.mu.Lock()
+	defer t.db.mu.Unlock()
+
+	if err := t.Transaction.Commit(ctx); err != nil {
+		return err
+	}
+	if len(t.ops) == 0 {
+		return nil
+	}
+	record, err := json.Marshal(t.ops)
+	if err != nil {
+		return err
+	}
+	_, err = t.db.log.Write(append(record, '\n'))
+	return err
+}
+
+func TestCrashConsistencyFileDB(t *testing.T) {
+	TestCrashConsistency(context.Background(), t, openFileDB)
+}
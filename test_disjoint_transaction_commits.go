@@ -6,6 +6,7 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/visvasity/kv"
 )
@@ -13,6 +14,8 @@ import (
 // TestDisjointTransactionCommit verifies that concurrent transactions
 // modifying completely disjoint keys all commit successfully.
 // There must be no spurious conflicts when keys do not overlap.
+// Every transaction sleeps for a random, seeded jitter between its operations
+// (see SeedEnv).
 func TestDisjointTransactionCommit(ctx context.Context, t *testing.T, db kv.Database) {
 	const prefix = "/TestDisjointTransactionCommit/"
 
@@ -22,12 +25,15 @@ func TestDisjointTransactionCommit(ctx context.Context, t *testing.T, db kv.Data
 	const numTxns = 100
 	const value = "data"
 
+	seed := caseSeed(ctx, t, prefix)
+
 	// Each transaction gets its own unique key → truly disjoint
 	var wg sync.WaitGroup
 	errs := make(chan error, numTxns)
 
 	for i := 0; i < numTxns; i++ {
 		wg.Add(1)
+		rnd := seededRand(seed, i)
 		go func(id int) {
 			defer wg.Done()
 
@@ -39,12 +45,14 @@ func TestDisjointTransactionCommit(ctx context.Context, t *testing.T, db kv.Data
 				return
 			}
 
+			jitter(rnd, time.Millisecond)
 			if err := tx.Set(ctx, key, strings.NewReader(value)); err != nil {
 				tx.Rollback(ctx)
 				errs <- err
 				return
 			}
 
+			jitter(rnd, time.Millisecond)
 			if err := tx.Commit(ctx); err != nil {
 				errs <- err
 				return
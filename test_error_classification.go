@@ -0,0 +1,139 @@
+package kvtests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/visvasity/kv"
+)
+
+// TestErrorClassification verifies that errors returned by the database fall
+// into the expected ErrorClass:
+//
+//   - A commit that loses a read-write race fails with a conflict error
+//   - Rolling back a rolled back transaction is ignored or reports closed
+//   - Invalid arguments are reported as invalid, never as conflicts
+//   - Writes to a committed transaction fail, but never as conflicts
+func TestErrorClassification(ctx context.Context, t *testing.T, db kv.Database) {
+	const prefix = "/TestErrorClassification/"
+
+	cleanupPrefix(ctx, t, db, prefix)
+	defer cleanupPrefix(ctx, t, db, prefix)
+
+	const key = prefix + "key"
+
+	t.Run("conflict", func(t *testing.T) {
+		tx0, err := db.NewTransaction(ctx)
+		if err != nil {
+			t.Fatalf("NewTransaction (initial): %v", err)
+		}
+		if err := tx0.Set(ctx, key, strings.NewReader("initial")); err != nil {
+			t.Fatalf("Set initial: %v", err)
+		}
+		if err := tx0.Commit(ctx); err != nil {
+			t.Fatalf("Commit initial: %v", err)
+		}
+
+		tx1, err := db.NewTransaction(ctx)
+		if err != nil {
+			t.Fatalf("NewTransaction (tx1): %v", err)
+		}
+		defer tx1.Rollback(ctx)
+
+		tx2, err := db.NewTransaction(ctx)
+		if err != nil {
+			t.Fatalf("NewTransaction (tx2): %v", err)
+		}
+		defer tx2.Rollback(ctx)
+
+		// Both transactions read the key before either one writes it
+		if _, err := tx1.Get(ctx, key); err != nil {
+			t.Fatalf("tx1.Get: %v", err)
+		}
+		if _, err := tx2.Get(ctx, key); err != nil {
+			t.Fatalf("tx2.Get: %v", err)
+		}
+
+		if err := tx1.Set(ctx, key, strings.NewReader("tx1")); err != nil {
+			t.Fatalf("tx1.Set: %v", err)
+		}
+		if err := tx1.Commit(ctx); err != nil {
+			t.Fatalf("tx1.Commit: %v", err)
+		}
+
+		// Some databases report the conflict as early as the write
+		if err := tx2.Set(ctx, key, strings.NewReader("tx2")); err != nil {
+			if c := classify(ctx, err); c != ClassConflict {
+				t.Errorf("tx2.Set failed with error class %v (%v); want %v", c, err, ClassConflict)
+			}
+			return
+		}
+		err = tx2.Commit(ctx)
+		if err == nil {
+			t.Fatal("tx2.Commit succeeded after a concurrent commit overwrote the key it read")
+		}
+		if c := classify(ctx, err); c != ClassConflict {
+			t.Errorf("tx2.Commit failed with error class %v (%v); want %v", c, err, ClassConflict)
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		tx, err := db.NewTransaction(ctx)
+		if err != nil {
+			t.Fatalf("NewTransaction: %v", err)
+		}
+		if err := tx.Rollback(ctx); err != nil {
+			t.Fatalf("Rollback: %v", err)
+		}
+		if err := tx.Rollback(ctx); err != nil {
+			if c := classify(ctx, err); c != ClassClosed {
+				t.Errorf("Second Rollback failed with error class %v (%v); want %v", c, err, ClassClosed)
+			}
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		tx, err := db.NewTransaction(ctx)
+		if err != nil {
+			t.Fatalf("NewTransaction: %v", err)
+		}
+		defer tx.Rollback(ctx)
+
+		if err := tx.Set(ctx, "", strings.NewReader("value")); classify(ctx, err) != ClassInvalid {
+			t.Errorf("Set(empty key) error class is %v (%v); want %v", classify(ctx, err), err, ClassInvalid)
+		}
+		if err := tx.Set(ctx, key, nil); classify(ctx, err) != ClassInvalid {
+			t.Errorf("Set(nil value) error class is %v (%v); want %v", classify(ctx, err), err, ClassInvalid)
+		}
+
+		var iterErr error
+		for range tx.Ascend(ctx, prefix+"b", prefix+"a", &iterErr) {
+			t.Fatal("Ascend iterated on invalid range")
+		}
+		if c := classify(ctx, iterErr); c != ClassInvalid {
+			t.Errorf("Ascend(begin > end) error class is %v (%v); want %v", c, iterErr, ClassInvalid)
+		}
+	})
+
+	t.Run("use after commit", func(t *testing.T) {
+		tx, err := db.NewTransaction(ctx)
+		if err != nil {
+			t.Fatalf("NewTransaction: %v", err)
+		}
+		if err := tx.Set(ctx, key, strings.NewReader("committed")); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			t.Fatalf("Commit: %v", err)
+		}
+
+		err = tx.Set(ctx, key, strings.NewReader("after-commit"))
+		if err == nil {
+			t.Fatal("Set on a committed transaction succeeded")
+		}
+		if c := classify(ctx, err); c == ClassConflict {
+			t.Errorf("Set on a committed transaction failed with error class %v (%v); retrying cannot help", c, err)
+		}
+	})
+}
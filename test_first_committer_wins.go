@@ -0,0 +1,157 @@
+package kvtests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/visvasity/kv"
+)
+
+// TestFirstCommitterWins verifies first-committer-wins ordering for two
+// overlapping read-modify-write transactions A and B on the same key. For each
+// interleaving, exactly the transaction that commits second must fail with a
+// conflict error, and the final value must be the winner's.
+//
+// Transactions that do not overlap in time must both commit. A transaction
+// that begins after another one commits begins only after the commit is
+// complete, even if the database blocks.
+//
+// Databases that block conflicting writes until the other transaction finishes
+// may decide the winner by lock order instead of commit order; for such
+// interleavings only the existence of a single winner is checked.
+func TestFirstCommitterWins(ctx context.Context, t *testing.T, db kv.Database) {
+	const prefix = "/TestFirstCommitterWins/"
+
+	cleanupPrefix(ctx, t, db, prefix)
+	defer cleanupPrefix(ctx, t, db, prefix)
+
+	const key = prefix + "key"
+
+	// Each schedule is a sequence of "<txn> <op>" steps, where op is one of
+	// begin, get, set or commit.
+	tests := []struct {
+		name     string
+		schedule []string
+		winner   string // empty when both must commit
+	}{
+		{
+			name:     "A writes first, A commits first",
+			schedule: []string{"A begin", "B begin", "A get", "B get", "A set", "B set", "A commit", "B commit"},
+			winner:   "A",
+		},
+		{
+			name:     "A writes first, B commits first",
+			schedule: []string{"A begin", "B begin", "A get", "B get", "A set", "B set", "B commit", "A commit"},
+			winner:   "B",
+		},
+		{
+			name:     "B writes first, A commits first",
+			schedule: []string{"A begin", "B begin", "B get", "A get", "B set", "A set", "A commit", "B commit"},
+			winner:   "A",
+		},
+		{
+			name:     "B begins first, A commits first",
+			schedule: []string{"B begin", "A begin", "A get", "B get", "B set", "A set", "A commit", "B commit"},
+			winner:   "A",
+		},
+		{
+			name:     "B begins after A commits",
+			schedule: []string{"A begin", "A get", "A set", "A commit", "B begin", "B get", "B set", "B commit"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// Reset the key to a known committed value
+			tx, err := db.NewTransaction(ctx)
+			if err != nil {
+				t.Fatalf("NewTransaction (reset): %v", err)
+			}
+			if err := tx.Set(ctx, key, strings.NewReader("initial")); err != nil {
+				t.Fatalf("Set initial: %v", err)
+			}
+			if err := tx.Commit(ctx); err != nil {
+				t.Fatalf("Commit initial: %v", err)
+			}
+
+			txns := make(map[string]*txnStepper)
+			for _, step := range tc.schedule {
+				name, op, _ := strings.Cut(step, " ")
+				if op == "begin" {
+					if tc.winner == "" {
+						// The transaction must not overlap the earlier ones.
+						for _, s := range txns {
+							s.settle()
+						}
+					}
+					txns[name] = newTxnStepper(ctx, t, db, name)
+					continue
+				}
+				s := txns[name]
+				switch op {
+				case "get":
+					s.get(ctx, key)
+				case "set":
+					s.set(ctx, key, name)
+				case "commit":
+					s.commit(ctx)
+				}
+			}
+
+			errs := make(map[string]error)
+			blocked := false
+			for name, s := range txns {
+				errs[name] = s.wait()
+				blocked = blocked || s.blocked
+			}
+
+			if tc.winner == "" {
+				for name, err := range errs {
+					if err != nil {
+						t.Errorf("Transaction %s failed: %v; non-overlapping transactions must both commit", name, err)
+					}
+				}
+				if err := checkLatest(ctx, db, key, "B"); err != nil {
+					t.Error(err)
+				}
+				return
+			}
+
+			winner := tc.winner
+			if blocked {
+				// Lock order decides the winner; accept either one.
+				if errs["A"] == nil {
+					winner = "A"
+				} else {
+					winner = "B"
+				}
+				t.Logf("Conflicting operations blocked; %s won by lock order", winner)
+			}
+			loser := map[string]string{"A": "B", "B": "A"}[winner]
+
+			if err := errs[winner]; err != nil {
+				t.Errorf("Transaction %s (first committer) failed: %v", winner, err)
+			}
+			if err := errs[loser]; err == nil {
+				t.Errorf("Transaction %s (second committer) committed; want a conflict", loser)
+			} else if classify(ctx, err) != ClassConflict {
+				t.Errorf("Transaction %s (second committer) failed with error class %v (%v); want %v", loser, classify(ctx, err), err, ClassConflict)
+			}
+			if err := checkLatest(ctx, db, key, winner); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// checkLatest verifies the key's value in a new snapshot.
+func checkLatest(ctx context.Context, db kv.Database, key, want string) error {
+	snap, err := db.NewSnapshot(ctx)
+	if err != nil {
+		return err
+	}
+	defer snap.Discard(ctx)
+
+	return checkValue(ctx, snap, key, want)
+}
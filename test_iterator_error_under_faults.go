@@ -0,0 +1,110 @@
+package kvtests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"strings"
+	"testing"
+
+	"github.com/visvasity/kv"
+	"github.com/visvasity/kv/kvutil"
+	"github.com/visvasity/kvtests/faultproxy"
+)
+
+// TestIteratorErrorUnderFaults verifies that an Ascend or Descend that is cut
+// short because the connection to a remote database is dropped, stalled or
+// reset in the middle of the range reports the failure through its error
+// out-parameter, instead of silently ending early, and that every item
+// returned before the failure is correct.
+//
+// The test is skipped if the database doesn't implement the FaultProxied
+// interface.
+func TestIteratorErrorUnderFaults(ctx context.Context, t *testing.T, db kv.Database) {
+	p := faultProxy(t, db)
+
+	const prefix = "/TestIteratorErrorUnderFaults/"
+
+	cleanupPrefix(ctx, t, db, prefix)
+	defer cleanupPrefix(ctx, t, db, prefix)
+
+	// The range must be much larger than the bytes let through before the
+	// fault, so that the fault hits in the middle of the range.
+	const (
+		numKeys    = 256
+		valueSize  = 1024
+		faultAfter = 32 << 10
+	)
+
+	value := func(i int) string {
+		return fmt.Sprintf("%04d", i) + strings.Repeat("v", valueSize-4)
+	}
+	tx, err := db.NewTransaction(ctx)
+	if err != nil {
+		t.Fatalf("NewTransaction: %v", err)
+	}
+	for i := 0; i < numKeys; i++ {
+		key := fmt.Sprintf("%skey-%04d", prefix, i)
+		if err := tx.Set(ctx, key, strings.NewReader(value(i))); err != nil {
+			t.Fatalf("Set %q: %v", key, err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	for _, order := range []string{"Ascend", "Descend"} {
+		for _, kind := range []faultproxy.Kind{faultproxy.Drop, faultproxy.Stall, faultproxy.Reset} {
+			f := faultproxy.Fault{Kind: kind, Direction: faultproxy.ToClient, After: faultAfter}
+			t.Run(fmt.Sprintf("%s-%s", order, kind), func(t *testing.T) {
+				snap, err := db.NewSnapshot(ctx)
+				if err != nil {
+					t.Fatalf("NewSnapshot: %v", err)
+				}
+				defer snap.Discard(ctx)
+
+				cctx, cancel := context.WithTimeout(ctx, faultTimeout)
+				defer cancel()
+
+				begin, end := kvutil.PrefixRange(prefix)
+				var iterErr error
+				var seq iter.Seq2[string, io.Reader]
+				if order == "Ascend" {
+					seq = snap.Ascend(cctx, begin, end, &iterErr)
+				} else {
+					seq = snap.Descend(cctx, begin, end, &iterErr)
+				}
+
+				hit := p.Inject(f)
+				count := 0
+				for key, val := range seq {
+					i := count
+					if order == "Descend" {
+						i = numKeys - 1 - count
+					}
+					if want := fmt.Sprintf("%skey-%04d", prefix, i); key != want {
+						t.Fatalf("%s item %d under fault %v has key %q; want %q", order, count, f, key, want)
+					}
+					if err := checkReader(key, val, value(i)); err != nil {
+						t.Fatalf("%s under fault %v: %v", order, f, err)
+					}
+					count++
+				}
+				p.Clear()
+
+				select {
+				case <-hit:
+				default:
+					t.Fatalf("%s did not receive %d bytes through the fault proxy", order, faultAfter)
+				}
+				switch {
+				case iterErr == nil && count != numKeys:
+					t.Errorf("%s under fault %v returned %d of %d items without an error", order, f, count, numKeys)
+				case iterErr != nil:
+					t.Logf("%s under fault %v failed after %d of %d items: %v", order, f, count, numKeys, iterErr)
+				}
+			})
+		}
+	}
+}
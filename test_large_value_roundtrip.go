@@ -3,8 +3,9 @@ package kvtests
 import (
 	"bytes"
 	"context"
-	"crypto/rand"
+	"encoding/binary"
 	"io"
+	"math/rand/v2"
 	"testing"
 
 	"github.com/visvasity/kv"
@@ -20,6 +21,10 @@ func TestLargeValueRoundtrip(ctx context.Context, t *testing.T, db kv.Database)
 
 	const key = prefix + "large"
 
+	var chachaSeed [32]byte
+	binary.LittleEndian.PutUint64(chachaSeed[:], caseSeed(ctx, t, prefix))
+	rnd := rand.NewChaCha8(chachaSeed)
+
 	tests := []struct {
 		name string
 		size int64 // in bytes
@@ -31,9 +36,9 @@ func TestLargeValueRoundtrip(ctx context.Context, t *testing.T, db kv.Database)
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			// Generate random data of exact size
+			// Generate random data of exact size from the seed
 			original := make([]byte, tc.size)
-			if _, err := rand.Read(original); err != nil {
+			if _, err := rnd.Read(original); err != nil {
 				t.Fatalf("Failed to generate random data: %v", err)
 			}
 
@@ -0,0 +1,117 @@
+package kvtests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/visvasity/kv"
+)
+
+// TestLostUpdateInterleavings verifies that no interleaving of concurrent
+// read-modify-write transactions on a counter loses an update: every
+// transaction either commits its increment or fails with a conflict, at least
+// one transaction commits, and the final counter equals the number of
+// committed transactions.
+//
+// All schedules of two transactions are enumerated with an Exploration, and
+// random schedules of three transactions are sampled using the run seed (see
+// SeedEnv).
+func TestLostUpdateInterleavings(ctx context.Context, t *testing.T, db kv.Database) {
+	const prefix = "/TestLostUpdateInterleavings/"
+
+	cleanupPrefix(ctx, t, db, prefix)
+	defer cleanupPrefix(ctx, t, db, prefix)
+
+	const key = prefix + "counter"
+
+	setup := func(ctx context.Context, db kv.Database) error {
+		tx, err := db.NewTransaction(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+
+		if err := tx.Set(ctx, key, strings.NewReader("0")); err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+	}
+
+	increment := func(ctx context.Context, db kv.Database) error {
+		tx, err := db.NewTransaction(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+
+		r, err := tx.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		n, err := strconv.Atoi(string(data))
+		if err != nil {
+			return fmt.Errorf("invalid counter value %q: %w", data, err)
+		}
+		if err := tx.Set(ctx, key, strings.NewReader(strconv.Itoa(n+1))); err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+	}
+
+	check := func(ctx context.Context, db kv.Database, errs []error) error {
+		committed := 0
+		for i, err := range errs {
+			if err == nil {
+				committed++
+			} else if classify(ctx, err) != ClassConflict {
+				return fmt.Errorf("transaction %d failed with error class %s (%v); want success or conflict", i, classify(ctx, err), err)
+			}
+		}
+		if committed == 0 {
+			return fmt.Errorf("no transaction committed; at least one must succeed")
+		}
+		snap, err := db.NewSnapshot(ctx)
+		if err != nil {
+			return err
+		}
+		defer snap.Discard(ctx)
+
+		if err := checkValue(ctx, snap, key, strconv.Itoa(committed)); err != nil {
+			return fmt.Errorf("after %d committed increments (lost update?): %w", committed, err)
+		}
+		return nil
+	}
+
+	t.Run("two transactions, all schedules", func(t *testing.T) {
+		e := &Exploration{
+			Setup:    setup,
+			Programs: []Program{increment, increment},
+			Check:    check,
+		}
+		n := e.Run(ctx, t, db)
+		t.Logf("explored %d schedules", n)
+	})
+
+	t.Run("three transactions, random schedules", func(t *testing.T) {
+		e := &Exploration{
+			Name:     prefix + "random",
+			Setup:    setup,
+			Programs: []Program{increment, increment, increment},
+			Check:    check,
+			Random:   true,
+		}
+		if testing.Short() {
+			e.MaxSchedules = 20
+		}
+		n := e.Run(ctx, t, db)
+		t.Logf("sampled %d schedules", n)
+	})
+}
@@ -0,0 +1,131 @@
+package kvtests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/visvasity/kv"
+)
+
+// TestManySnapshots extends TestSnapshotFrozenAtCreation to thousands of
+// simultaneously open snapshots, as in a read fan-out pattern. Snapshots are
+// opened at staggered points of a write sequence and each one must
+// independently see exactly the state at its creation.
+//
+// The average cost of creating a snapshot and the heap memory retained per
+// open snapshot (for in-process databases) are logged.
+func TestManySnapshots(ctx context.Context, t *testing.T, db kv.Database) {
+	const prefix = "/TestManySnapshots/"
+
+	cleanupPrefix(ctx, t, db, prefix)
+	defer cleanupPrefix(ctx, t, db, prefix)
+
+	numSnapshots := 5000
+	if testing.Short() {
+		numSnapshots = 1000
+	}
+
+	const counterKey = prefix + "counter"
+	itemKey := func(i int) string { return fmt.Sprintf("%sitem-%05d", prefix, i) }
+
+	snaps := make([]kv.Snapshot, 0, numSnapshots)
+	defer func() {
+		for _, snap := range snaps {
+			snap.Discard(ctx)
+		}
+	}()
+
+	var snapshotTime time.Duration
+	for i := 0; i < numSnapshots; i++ {
+		tx, err := db.NewTransaction(ctx)
+		if err != nil {
+			t.Fatalf("NewTransaction (step %d): %v", i, err)
+		}
+		value := strconv.Itoa(i)
+		if err := tx.Set(ctx, counterKey, strings.NewReader(value)); err != nil {
+			t.Fatalf("Set counter (step %d): %v", i, err)
+		}
+		if err := tx.Set(ctx, itemKey(i), strings.NewReader(value)); err != nil {
+			t.Fatalf("Set item (step %d): %v", i, err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			t.Fatalf("Commit (step %d): %v", i, err)
+		}
+
+		start := time.Now()
+		snap, err := db.NewSnapshot(ctx)
+		if err != nil {
+			t.Fatalf("NewSnapshot (step %d, %d snapshots open): %v", i, len(snaps), err)
+		}
+		snaps = append(snaps, snap)
+
+		// Force the snapshot point for databases that pick it on first read.
+		if err := checkValue(ctx, snap, counterKey, value); err != nil {
+			t.Fatalf("Snapshot %d at creation: %v", i, err)
+		}
+		snapshotTime += time.Since(start)
+	}
+
+	runtime.GC()
+	var open runtime.MemStats
+	runtime.ReadMemStats(&open)
+
+	// Verify every snapshot; do a full scan on a sample of them
+	scanEvery := max(1, numSnapshots/10)
+	for i, snap := range snaps {
+		if err := checkValue(ctx, snap, counterKey, strconv.Itoa(i)); err != nil {
+			t.Errorf("Snapshot %d: %v", i, err)
+		}
+		if err := checkValue(ctx, snap, itemKey(i), strconv.Itoa(i)); err != nil {
+			t.Errorf("Snapshot %d: %v", i, err)
+		}
+		if _, err := snap.Get(ctx, itemKey(i+1)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Snapshot %d: Get(%q) = %v; want os.ErrNotExist", i, itemKey(i+1), err)
+		}
+
+		if i%scanEvery != 0 && i != numSnapshots-1 {
+			continue
+		}
+		count := 0
+		var iterErr error
+		for key, val := range snap.Ascend(ctx, prefix+"item-", prefix+"item.", &iterErr) {
+			if want := itemKey(count); key != want {
+				t.Errorf("Snapshot %d: scan saw key %q; want %q", i, key, want)
+				break
+			}
+			if err := checkReader(key, val, strconv.Itoa(count)); err != nil {
+				t.Errorf("Snapshot %d: %v", i, err)
+			}
+			count++
+		}
+		if iterErr != nil {
+			t.Errorf("Snapshot %d: Ascend: %v", i, iterErr)
+		}
+		if count != i+1 {
+			t.Errorf("Snapshot %d: scan saw %d items; want %d", i, count, i+1)
+		}
+	}
+
+	for _, snap := range snaps {
+		if err := snap.Discard(ctx); err != nil {
+			t.Errorf("Discard: %v", err)
+		}
+	}
+	snaps = nil
+
+	runtime.GC()
+	var discarded runtime.MemStats
+	runtime.ReadMemStats(&discarded)
+
+	t.Logf("%d snapshots: %v per NewSnapshot (including the first read)", numSnapshots, snapshotTime/time.Duration(numSnapshots))
+	if open.HeapAlloc > discarded.HeapAlloc {
+		t.Logf("%d snapshots: ~%d heap bytes retained per open snapshot", numSnapshots, (open.HeapAlloc-discarded.HeapAlloc)/uint64(numSnapshots))
+	}
+}
@@ -0,0 +1,136 @@
+package kvtests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/visvasity/kv"
+	"github.com/visvasity/kv/kvutil"
+)
+
+// TestReadOnlyTransactionCommit verifies commit semantics of transactions that
+// only read:
+//
+//   - A read-only transaction without concurrent writes always commits
+//   - A read-only transaction whose read key is changed by a concurrent commit
+//     always commits under snapshot isolation; serializable databases may
+//     abort it, but only with a conflict error
+//   - Committing a read-only transaction never aborts a concurrent writer
+func TestReadOnlyTransactionCommit(ctx context.Context, t *testing.T, db kv.Database) {
+	const prefix = "/TestReadOnlyTransactionCommit/"
+
+	cleanupPrefix(ctx, t, db, prefix)
+	defer cleanupPrefix(ctx, t, db, prefix)
+
+	const key = prefix + "key"
+
+	caps := capabilitiesOf(ctx, db)
+
+	setKey := func(t *testing.T, value string) {
+		t.Helper()
+
+		tx, err := db.NewTransaction(ctx)
+		if err != nil {
+			t.Fatalf("NewTransaction: %v", err)
+		}
+		if err := tx.Set(ctx, key, strings.NewReader(value)); err != nil {
+			t.Fatalf("Set %q: %v", value, err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			t.Fatalf("Commit %q: %v", value, err)
+		}
+	}
+
+	t.Run("no concurrent writes", func(t *testing.T) {
+		setKey(t, "initial")
+
+		ro, err := db.NewTransaction(ctx)
+		if err != nil {
+			t.Fatalf("NewTransaction: %v", err)
+		}
+		defer ro.Rollback(ctx)
+
+		if err := checkValue(ctx, ro, key, "initial"); err != nil {
+			t.Fatal(err)
+		}
+		begin, end := kvutil.PrefixRange(prefix)
+		var iterErr error
+		for range ro.Ascend(ctx, begin, end, &iterErr) {
+		}
+		if iterErr != nil {
+			t.Fatalf("Ascend: %v", iterErr)
+		}
+		if err := ro.Commit(ctx); err != nil {
+			t.Errorf("Read-only Commit failed: %v", err)
+		}
+	})
+
+	t.Run("read key changed", func(t *testing.T) {
+		setKey(t, "initial")
+
+		ro, err := db.NewTransaction(ctx)
+		if err != nil {
+			t.Fatalf("NewTransaction: %v", err)
+		}
+		defer ro.Rollback(ctx)
+
+		if err := checkValue(ctx, ro, key, "initial"); err != nil {
+			t.Fatal(err)
+		}
+
+		setKey(t, "changed")
+
+		// The read-only transaction must keep seeing its snapshot
+		if err := checkValue(ctx, ro, key, "initial"); err != nil {
+			t.Errorf("Read-only transaction after concurrent commit: %v", err)
+		}
+
+		err = ro.Commit(ctx)
+		switch {
+		case err == nil:
+		case !caps.Serializable:
+			t.Errorf("Read-only Commit failed under snapshot isolation: %v", err)
+		case classify(ctx, err) != ClassConflict:
+			t.Errorf("Read-only Commit failed with error class %v (%v); want %v", classify(ctx, err), err, ClassConflict)
+		default:
+			t.Logf("Read-only Commit aborted by serializable database: %v", err)
+		}
+	})
+
+	t.Run("concurrent writer", func(t *testing.T) {
+		setKey(t, "initial")
+
+		ro, err := db.NewTransaction(ctx)
+		if err != nil {
+			t.Fatalf("NewTransaction (read-only): %v", err)
+		}
+		defer ro.Rollback(ctx)
+
+		rw, err := db.NewTransaction(ctx)
+		if err != nil {
+			t.Fatalf("NewTransaction (writer): %v", err)
+		}
+		defer rw.Rollback(ctx)
+
+		if err := checkValue(ctx, ro, key, "initial"); err != nil {
+			t.Fatal(err)
+		}
+		if err := checkValue(ctx, rw, key, "initial"); err != nil {
+			t.Fatal(err)
+		}
+		if err := rw.Set(ctx, key, strings.NewReader("written")); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+
+		if err := ro.Commit(ctx); err != nil {
+			t.Errorf("Read-only Commit failed: %v", err)
+		}
+		if err := rw.Commit(ctx); err != nil {
+			t.Errorf("Writer Commit failed after a read-only transaction committed: %v", err)
+		}
+		if err := checkLatest(ctx, db, key, "written"); err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package kvtests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/visvasity/kv"
+	"github.com/visvasity/kv/kvutil"
+)
+
+// TestReopenCommittedVisible verifies that every successfully committed
+// transaction — including overwrites and deletes — is visible after the
+// database is closed and reopened.
+//
+// The test is skipped if the database doesn't implement the Reopener interface.
+func TestReopenCommittedVisible(ctx context.Context, t *testing.T, db kv.Database) {
+	r := reopener(t, db)
+
+	const prefix = "/TestReopenCommittedVisible/"
+
+	cleanupPrefix(ctx, t, db, prefix)
+	defer cleanupPrefix(ctx, t, db, prefix)
+
+	const numTxns = 10
+
+	want := make(map[string]string)
+	for i := 0; i < numTxns; i++ {
+		tx, err := db.NewTransaction(ctx)
+		if err != nil {
+			t.Fatalf("NewTransaction (txn %d): %v", i, err)
+		}
+		for j := 0; j <= i; j++ {
+			key := fmt.Sprintf("%skey-%02d", prefix, j)
+			value := fmt.Sprintf("txn-%02d", i)
+			if err := tx.Set(ctx, key, strings.NewReader(value)); err != nil {
+				t.Fatalf("Set %q (txn %d): %v", key, i, err)
+			}
+			want[key] = value
+		}
+		if err := tx.Commit(ctx); err != nil {
+			t.Fatalf("Commit (txn %d): %v", i, err)
+		}
+	}
+
+	// Delete a key in a separate committed transaction
+	deleted := fmt.Sprintf("%skey-%02d", prefix, 0)
+	tx, err := db.NewTransaction(ctx)
+	if err != nil {
+		t.Fatalf("NewTransaction (delete): %v", err)
+	}
+	if err := tx.Delete(ctx, deleted); err != nil {
+		t.Fatalf("Delete %q: %v", deleted, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("Commit (delete): %v", err)
+	}
+	delete(want, deleted)
+
+	reopen(ctx, t, r)
+
+	snap, err := db.NewSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("NewSnapshot after reopen: %v", err)
+	}
+	defer snap.Discard(ctx)
+
+	got := make(map[string]string)
+	begin, end := kvutil.PrefixRange(prefix)
+	var iterErr error
+	for key, val := range snap.Ascend(ctx, begin, end, &iterErr) {
+		data, err := io.ReadAll(val)
+		if err != nil {
+			t.Fatalf("io.ReadAll(%q) after reopen: %v", key, err)
+		}
+		got[key] = string(data)
+	}
+	if iterErr != nil {
+		t.Fatalf("Ascend after reopen: %v", iterErr)
+	}
+
+	for key, value := range want {
+		if v, ok := got[key]; !ok {
+			t.Errorf("Key %q is lost after reopen", key)
+		} else if v != value {
+			t.Errorf("Key %q = %q after reopen; want %q", key, v, value)
+		}
+	}
+	if _, ok := got[deleted]; ok {
+		t.Errorf("Deleted key %q is visible after reopen", deleted)
+	}
+}
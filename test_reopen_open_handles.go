@@ -0,0 +1,106 @@
+package kvtests
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/visvasity/kv"
+	"github.com/visvasity/kv/kvutil"
+)
+
+// TestReopenOpenHandles verifies that closing the database while transactions
+// and snapshots are still open (and an iteration is in progress) does not
+// corrupt the store: the reopened database must contain exactly the committed
+// state and must accept new transactions.
+//
+// The test is skipped if the database doesn't implement the Reopener interface.
+func TestReopenOpenHandles(ctx context.Context, t *testing.T, db kv.Database) {
+	r := reopener(t, db)
+
+	const prefix = "/TestReopenOpenHandles/"
+
+	cleanupPrefix(ctx, t, db, prefix)
+	defer cleanupPrefix(ctx, t, db, prefix)
+
+	const numKeys = 20
+
+	tx, err := db.NewTransaction(ctx)
+	if err != nil {
+		t.Fatalf("NewTransaction: %v", err)
+	}
+	for i := 0; i < numKeys; i++ {
+		key := fmt.Sprintf("%skey-%02d", prefix, i)
+		if err := tx.Set(ctx, key, strings.NewReader("v1")); err != nil {
+			t.Fatalf("Set %q: %v", key, err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	// Leave a snapshot open with a partially consumed iterator
+	snap, err := db.NewSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("NewSnapshot: %v", err)
+	}
+	begin, end := kvutil.PrefixRange(prefix)
+	var iterErr error
+	for range snap.Ascend(ctx, begin, end, &iterErr) {
+		break
+	}
+	if iterErr != nil {
+		t.Fatalf("Ascend: %v", iterErr)
+	}
+
+	// Leave a transaction open with pending writes
+	otx, err := db.NewTransaction(ctx)
+	if err != nil {
+		t.Fatalf("NewTransaction (open): %v", err)
+	}
+	for i := 0; i < numKeys; i += 2 {
+		key := fmt.Sprintf("%skey-%02d", prefix, i)
+		if err := otx.Set(ctx, key, strings.NewReader("uncommitted")); err != nil {
+			t.Fatalf("Set %q (open): %v", key, err)
+		}
+	}
+
+	reopen(ctx, t, r)
+
+	// Abandoned handles may fail in any way, but must not panic or hang
+	_ = otx.Rollback(ctx)
+	_ = snap.Discard(ctx)
+
+	check, err := db.NewSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("NewSnapshot after reopen: %v", err)
+	}
+	defer check.Discard(ctx)
+
+	count := 0
+	for key, val := range check.Ascend(ctx, begin, end, &iterErr) {
+		count++
+		if err := checkReader(key, val, "v1"); err != nil {
+			t.Errorf("After reopen: %v", err)
+		}
+	}
+	if iterErr != nil {
+		t.Fatalf("Ascend after reopen: %v", iterErr)
+	}
+	if count != numKeys {
+		t.Errorf("Found %d keys after reopen; want %d", count, numKeys)
+	}
+
+	// The reopened store must accept new writes
+	ntx, err := db.NewTransaction(ctx)
+	if err != nil {
+		t.Fatalf("NewTransaction after reopen: %v", err)
+	}
+	if err := ntx.Set(ctx, prefix+"after-reopen", strings.NewReader("v2")); err != nil {
+		t.Fatalf("Set after reopen: %v", err)
+	}
+	if err := ntx.Commit(ctx); err != nil {
+		t.Fatalf("Commit after reopen: %v", err)
+	}
+}
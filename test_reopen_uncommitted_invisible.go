@@ -0,0 +1,87 @@
+package kvtests
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/visvasity/kv"
+)
+
+// TestReopenUncommittedInvisible verifies that writes from rolled back
+// transactions and from transactions that were still open when the database
+// was closed are not visible after reopen.
+//
+// The test is skipped if the database doesn't implement the Reopener interface.
+func TestReopenUncommittedInvisible(ctx context.Context, t *testing.T, db kv.Database) {
+	r := reopener(t, db)
+
+	const prefix = "/TestReopenUncommittedInvisible/"
+
+	cleanupPrefix(ctx, t, db, prefix)
+	defer cleanupPrefix(ctx, t, db, prefix)
+
+	const (
+		committedKey  = prefix + "committed"
+		rolledBackKey = prefix + "rolled-back"
+		openKey       = prefix + "open"
+	)
+
+	// A committed write, so that an empty database is not mistaken for success
+	tx, err := db.NewTransaction(ctx)
+	if err != nil {
+		t.Fatalf("NewTransaction (committed): %v", err)
+	}
+	if err := tx.Set(ctx, committedKey, strings.NewReader("committed")); err != nil {
+		t.Fatalf("Set %q: %v", committedKey, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	// A rolled back write
+	rtx, err := db.NewTransaction(ctx)
+	if err != nil {
+		t.Fatalf("NewTransaction (rolled back): %v", err)
+	}
+	if err := rtx.Set(ctx, rolledBackKey, strings.NewReader("rolled-back")); err != nil {
+		t.Fatalf("Set %q: %v", rolledBackKey, err)
+	}
+	if err := rtx.Set(ctx, committedKey, strings.NewReader("rolled-back")); err != nil {
+		t.Fatalf("Set %q: %v", committedKey, err)
+	}
+	if err := rtx.Rollback(ctx); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+
+	// A write that is never committed before the database is closed
+	otx, err := db.NewTransaction(ctx)
+	if err != nil {
+		t.Fatalf("NewTransaction (open): %v", err)
+	}
+	if err := otx.Set(ctx, openKey, strings.NewReader("open")); err != nil {
+		t.Fatalf("Set %q: %v", openKey, err)
+	}
+	if err := otx.Delete(ctx, committedKey); err != nil {
+		t.Fatalf("Delete %q: %v", committedKey, err)
+	}
+
+	reopen(ctx, t, r)
+
+	snap, err := db.NewSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("NewSnapshot after reopen: %v", err)
+	}
+	defer snap.Discard(ctx)
+
+	if err := checkValue(ctx, snap, committedKey, "committed"); err != nil {
+		t.Errorf("After reopen: %v", err)
+	}
+	for _, key := range []string{rolledBackKey, openKey} {
+		if _, err := snap.Get(ctx, key); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Get(%q) after reopen = %v; want os.ErrNotExist", key, err)
+		}
+	}
+}
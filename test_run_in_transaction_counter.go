@@ -0,0 +1,123 @@
+package kvtests
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/visvasity/kv"
+)
+
+// TestRunInTransactionCounter verifies that RunInTransaction retries conflicting
+// read-modify-write transactions until they commit, and that the effects of
+// every call are applied exactly once: concurrent increments of a counter must
+// neither be lost nor applied twice. The first attempts of all workers read
+// and update the missing counter before any of them commits, and no worker
+// starts its second increment before all first increments are committed, so
+// that conflicts on reads of missing keys are exercised as well.
+func TestRunInTransactionCounter(ctx context.Context, t *testing.T, db kv.Database) {
+	const prefix = "/TestRunInTransactionCounter/"
+
+	cleanupPrefix(ctx, t, db, prefix)
+	defer cleanupPrefix(ctx, t, db, prefix)
+
+	const key = prefix + "counter"
+	const numWorkers = 10
+	const incrementsPerWorker = 5
+
+	seed := caseSeed(ctx, t, prefix)
+
+	// Workers wait for each other, but not forever, in case a worker failed.
+	updated := newCounterBarrier(numWorkers)
+	committed := newCounterBarrier(numWorkers)
+
+	var attempts, successes atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		opts := &RetryOptions{MaxAttempts: 1000, Rand: seededRand(seed, i)}
+		go func() {
+			defer wg.Done()
+
+			first := true
+			for j := 0; j < incrementsPerWorker; j++ {
+				err := RunInTransaction(ctx, db, func(ctx context.Context, tx kv.Transaction) error {
+					attempts.Add(1)
+
+					count := 0
+					r, err := tx.Get(ctx, key)
+					if err == nil {
+						data, err := io.ReadAll(r)
+						if err != nil {
+							return err
+						}
+						if count, err = strconv.Atoi(string(data)); err != nil {
+							return err
+						}
+					} else if !errors.Is(err, os.ErrNotExist) {
+						return err
+					}
+					if err := tx.Set(ctx, key, strings.NewReader(strconv.Itoa(count+1))); err != nil {
+						return err
+					}
+					if first {
+						first = false
+						updated.wait()
+					}
+					return nil
+				}, opts)
+				if err != nil {
+					t.Errorf("RunInTransaction failed: %v", err)
+					return
+				}
+				successes.Add(1)
+				if j == 0 {
+					committed.wait()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	t.Logf("%d increments took %d attempts", successes.Load(), attempts.Load())
+
+	snap, err := db.NewSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("NewSnapshot: %v", err)
+	}
+	defer snap.Discard(ctx)
+
+	want := strconv.Itoa(int(successes.Load()))
+	if err := checkValue(ctx, snap, key, want); err != nil {
+		t.Errorf("Counter after %s successful increments: %v", want, err)
+	}
+}
+
+// counterBarrier is a single-use barrier for a fixed number of goroutines.
+type counterBarrier struct {
+	n       int32
+	arrived atomic.Int32
+	ready   chan struct{}
+}
+
+func newCounterBarrier(n int) *counterBarrier {
+	return &counterBarrier{n: int32(n), ready: make(chan struct{})}
+}
+
+// wait blocks until all goroutines have called wait, or for at most a second.
+func (b *counterBarrier) wait() {
+	if b.arrived.Add(1) == b.n {
+		close(b.ready)
+	}
+	select {
+	case <-b.ready:
+	case <-time.After(time.Second):
+	}
+}
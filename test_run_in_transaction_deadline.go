@@ -0,0 +1,48 @@
+package kvtests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/visvasity/kv"
+)
+
+// TestRunInTransactionDeadline verifies that RunInTransaction stops retrying
+// when the context deadline expires, and that the returned error reports both
+// the deadline and the last conflict.
+func TestRunInTransactionDeadline(ctx context.Context, t *testing.T, db kv.Database) {
+	const timeout = 100 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	opts := &RetryOptions{
+		MaxAttempts:    1 << 30,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     10 * time.Millisecond,
+	}
+
+	start := time.Now()
+	attempts := 0
+	err := RunInTransaction(ctx, db, func(ctx context.Context, tx kv.Transaction) error {
+		attempts++
+		return fmt.Errorf("always conflicting: %w", ErrConflict)
+	}, opts)
+	elapsed := time.Since(start)
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RunInTransaction = %v; want an error matching context.DeadlineExceeded", err)
+	}
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("RunInTransaction = %v; want an error matching ErrConflict", err)
+	}
+	if attempts < 2 {
+		t.Errorf("Function was called %d times before the deadline; want retries", attempts)
+	}
+	if elapsed > 10*timeout {
+		t.Errorf("RunInTransaction returned %v after a %v deadline", elapsed, timeout)
+	}
+}
@@ -0,0 +1,77 @@
+package kvtests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/visvasity/kv"
+)
+
+// TestRunInTransactionRollback verifies that RunInTransaction rolls back the
+// transaction when the function returns an error or panics: the error (or
+// panic) reaches the caller unchanged, non-retryable errors are not retried,
+// no writes from the failed attempt become visible and no transaction is left
+// open.
+func TestRunInTransactionRollback(ctx context.Context, t *testing.T, db kv.Database) {
+	const prefix = "/TestRunInTransactionRollback/"
+
+	cleanupPrefix(ctx, t, db, prefix)
+	defer cleanupPrefix(ctx, t, db, prefix)
+
+	const key = prefix + "key"
+
+	errFailed := errors.New("function failed")
+
+	t.Run("error", func(t *testing.T) {
+		tdb := NewTrackingDatabase(db)
+
+		calls := 0
+		err := RunInTransaction(ctx, tdb, func(ctx context.Context, tx kv.Transaction) error {
+			calls++
+			if err := tx.Set(ctx, key, strings.NewReader("error")); err != nil {
+				return err
+			}
+			return fmt.Errorf("wrapped: %w", errFailed)
+		}, nil)
+		if !errors.Is(err, errFailed) {
+			t.Errorf("RunInTransaction = %v; want %v", err, errFailed)
+		}
+		if calls != 1 {
+			t.Errorf("Function was called %d times for a non-retryable error; want 1", calls)
+		}
+		tdb.Check(t)
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		tdb := NewTrackingDatabase(db)
+
+		func() {
+			defer func() {
+				if r := recover(); r != errFailed {
+					t.Errorf("recovered %v; want the original panic value %v", r, errFailed)
+				}
+			}()
+			RunInTransaction(ctx, tdb, func(ctx context.Context, tx kv.Transaction) error {
+				if err := tx.Set(ctx, key, strings.NewReader("panic")); err != nil {
+					return err
+				}
+				panic(errFailed)
+			}, nil)
+		}()
+		tdb.Check(t)
+	})
+
+	snap, err := db.NewSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("NewSnapshot: %v", err)
+	}
+	defer snap.Discard(ctx)
+
+	if _, err := snap.Get(ctx, key); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Get(%q) after failed attempts = %v; want os.ErrNotExist", key, err)
+	}
+}
@@ -0,0 +1,124 @@
+package kvtests
+
+import (
+	"context"
+	"iter"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/visvasity/kv"
+	"github.com/visvasity/kv/kvutil"
+)
+
+// TestSnapshotDoesNotBlockWriters verifies that an open snapshot — even one in
+// the middle of an iteration — never blocks concurrent writers. Overwrites,
+// deletes and inserts within the snapshot's range must commit within a
+// timeout, while the snapshot keeps seeing its original view.
+func TestSnapshotDoesNotBlockWriters(ctx context.Context, t *testing.T, db kv.Database) {
+	const prefix = "/TestSnapshotDoesNotBlockWriters/"
+
+	cleanupPrefix(ctx, t, db, prefix)
+	defer cleanupPrefix(ctx, t, db, prefix)
+
+	const timeout = 5 * time.Second
+
+	keys := []string{prefix + "a", prefix + "b", prefix + "c"}
+
+	tx, err := db.NewTransaction(ctx)
+	if err != nil {
+		t.Fatalf("NewTransaction: %v", err)
+	}
+	for _, k := range keys {
+		if err := tx.Set(ctx, k, strings.NewReader("v1")); err != nil {
+			t.Fatalf("Set %q: %v", k, err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	snap, err := db.NewSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("NewSnapshot: %v", err)
+	}
+	defer snap.Discard(ctx)
+
+	if err := checkValue(ctx, snap, keys[0], "v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hold an iteration open in the middle of the range
+	begin, end := kvutil.PrefixRange(prefix)
+	var iterErr error
+	next, stop := iter.Pull2(snap.Ascend(ctx, begin, end, &iterErr))
+	defer stop()
+
+	key, val, ok := next()
+	if !ok {
+		t.Fatalf("Ascend returned no keys (err: %v)", iterErr)
+	}
+	if err := checkReader(key, val, "v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writer must commit without waiting for the snapshot
+	done := make(chan error, 1)
+	start := time.Now()
+	go func() {
+		tx, err := db.NewTransaction(ctx)
+		if err != nil {
+			done <- err
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		if err := tx.Set(ctx, keys[0], strings.NewReader("v2")); err != nil {
+			done <- err
+			return
+		}
+		if err := tx.Delete(ctx, keys[1]); err != nil {
+			done <- err
+			return
+		}
+		if err := tx.Set(ctx, prefix+"d", strings.NewReader("v2")); err != nil {
+			done <- err
+			return
+		}
+		done <- tx.Commit(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Concurrent writer failed: %v", err)
+		}
+		t.Logf("Concurrent writer committed in %v with an open snapshot", time.Since(start))
+	case <-time.After(timeout):
+		t.Fatalf("Concurrent writer did not commit within %v; snapshot is blocking writers", timeout)
+	}
+
+	// The snapshot must be unaffected by the committed writes
+	var rest []string
+	for {
+		key, val, ok := next()
+		if !ok {
+			break
+		}
+		rest = append(rest, key)
+		if err := checkReader(key, val, "v1"); err != nil {
+			t.Errorf("Snapshot iteration after concurrent commit: %v", err)
+		}
+	}
+	if iterErr != nil {
+		t.Fatalf("Ascend: %v", iterErr)
+	}
+	if got, want := strings.Join(rest, ","), strings.Join(keys[1:], ","); got != want {
+		t.Errorf("Snapshot iteration after concurrent commit saw keys %s; want %s", got, want)
+	}
+	for _, k := range keys {
+		if err := checkValue(ctx, snap, k, "v1"); err != nil {
+			t.Errorf("Snapshot after concurrent commit: %v", err)
+		}
+	}
+}
@@ -14,11 +14,17 @@ import (
 // TestSnapshotIteratorStability verifies that a snapshot's iterator
 // remains completely stable and unaffected by concurrent writes.
 // Multiple iterations must see exactly the same keys and values.
+// The interleaving of the writer and the scans is varied by a random, seeded
+// jitter (see SeedEnv) on top of fixed minimum delays, so that the writer
+// always makes progress between the scans.
 func TestSnapshotIteratorStability(ctx context.Context, t *testing.T, db kv.Database) {
 	const prefix = "/TestSnapshotIteratorStability/"
 	cleanupPrefix(ctx, t, db, prefix)
 	defer cleanupPrefix(ctx, t, db, prefix)
 
+	seed := caseSeed(ctx, t, prefix)
+	rnd, writerRnd := seededRand(seed, 0), seededRand(seed, 1)
+
 	// Phase 1: Write initial known state
 	initialKeys := []string{
 		prefix + "a", prefix + "b", prefix + "c", prefix + "d", prefix + "e",
@@ -81,12 +87,14 @@ func TestSnapshotIteratorStability(ctx context.Context, t *testing.T, db kv.Data
 				done <- err
 				return
 			}
-			time.Sleep(1 * time.Millisecond)
+			time.Sleep(500 * time.Microsecond)
+			jitter(writerRnd, time.Millisecond)
 		}
 	}()
 
 	// Give writer time to start
-	time.Sleep(50 * time.Millisecond)
+	time.Sleep(25 * time.Millisecond)
+	jitter(rnd, 50*time.Millisecond)
 
 	// Phase 3: Multiple full scans of the snapshot — must be 100% stable
 	for round := 1; round <= 3; round++ {
@@ -121,7 +129,8 @@ func TestSnapshotIteratorStability(ctx context.Context, t *testing.T, db kv.Data
 			}
 		})
 
-		time.Sleep(20 * time.Millisecond)
+		time.Sleep(10 * time.Millisecond)
+		jitter(rnd, 20*time.Millisecond)
 	}
 
 	// Wait for background writer to finish and report any error
@@ -0,0 +1,180 @@
+package kvtests
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/visvasity/kv"
+	"github.com/visvasity/kv/kvutil"
+)
+
+// TestSnapshotUnderChurn is a soak test that keeps a snapshot open while
+// millions of versions (thousands in short mode) are written and deleted under
+// the same prefix. The snapshot must keep seeing exactly its original state
+// throughout.
+//
+// If the database implements StatsReporter, the test also verifies that old
+// versions are garbage collected once the snapshot is discarded.
+func TestSnapshotUnderChurn(ctx context.Context, t *testing.T, db kv.Database) {
+	const prefix = "/TestSnapshotUnderChurn/"
+
+	cleanupPrefix(ctx, t, db, prefix)
+	defer cleanupPrefix(ctx, t, db, prefix)
+
+	const (
+		numBaseKeys  = 100
+		numChurnKeys = 900
+		opsPerTxn    = 1000
+		numChecks    = 10
+	)
+	numVersions := 1_000_000
+	if testing.Short() {
+		numVersions = 20_000
+	}
+	numTxns := numVersions / opsPerTxn
+
+	baseKey := func(i int) string { return fmt.Sprintf("%sbase-%03d", prefix, i) }
+	churnKey := func(i int) string { return fmt.Sprintf("%schurn-%03d", prefix, i) }
+
+	tx, err := db.NewTransaction(ctx)
+	if err != nil {
+		t.Fatalf("NewTransaction: %v", err)
+	}
+	for i := 0; i < numBaseKeys; i++ {
+		if err := tx.Set(ctx, baseKey(i), strings.NewReader("v0")); err != nil {
+			t.Fatalf("Set %q: %v", baseKey(i), err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	snap, err := db.NewSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("NewSnapshot: %v", err)
+	}
+	discarded := false
+	defer func() {
+		if !discarded {
+			snap.Discard(ctx)
+		}
+	}()
+
+	// Force the snapshot point for databases that pick it on first read.
+	if err := checkValue(ctx, snap, baseKey(0), "v0"); err != nil {
+		t.Fatal(err)
+	}
+
+	checkSnapshot := func(txns int) {
+		t.Helper()
+
+		count := 0
+		begin, end := kvutil.PrefixRange(prefix)
+		var iterErr error
+		for key, val := range snap.Ascend(ctx, begin, end, &iterErr) {
+			if want := baseKey(count); key != want {
+				t.Fatalf("After %d transactions: snapshot saw key %q; want %q", txns, key, want)
+			}
+			if err := checkReader(key, val, "v0"); err != nil {
+				t.Fatalf("After %d transactions: snapshot: %v", txns, err)
+			}
+			count++
+		}
+		if iterErr != nil {
+			t.Fatalf("After %d transactions: snapshot Ascend: %v", txns, iterErr)
+		}
+		if count != numBaseKeys {
+			t.Fatalf("After %d transactions: snapshot saw %d keys; want %d", txns, count, numBaseKeys)
+		}
+	}
+
+	start := time.Now()
+	for n := 0; n < numTxns; n++ {
+		tx, err := db.NewTransaction(ctx)
+		if err != nil {
+			t.Fatalf("NewTransaction (txn %d): %v", n, err)
+		}
+		for j := 0; j < opsPerTxn; j++ {
+			// Alternate between overwriting and deleting every key, so that both
+			// live and deleted versions pile up.
+			i := j % (numBaseKeys + numChurnKeys)
+			key := baseKey(i)
+			if i >= numBaseKeys {
+				key = churnKey(i - numBaseKeys)
+			}
+			if n%2 == 0 {
+				err = tx.Set(ctx, key, strings.NewReader(fmt.Sprintf("v%d", n+1)))
+			} else {
+				err = tx.Delete(ctx, key)
+			}
+			if err != nil {
+				tx.Rollback(ctx)
+				t.Fatalf("Write %q (txn %d): %v", key, n, err)
+			}
+		}
+		if err := tx.Commit(ctx); err != nil {
+			t.Fatalf("Commit (txn %d): %v", n, err)
+		}
+
+		if (n+1)%max(1, numTxns/numChecks) == 0 {
+			checkSnapshot(n + 1)
+		}
+	}
+	t.Logf("Wrote %d versions in %v with a snapshot open", numTxns*opsPerTxn, time.Since(start))
+
+	reporter, ok := databaseAs[StatsReporter](db)
+	if !ok {
+		return
+	}
+
+	peak, err := reporter.StorageStats(ctx)
+	if err != nil {
+		t.Fatalf("StorageStats: %v", err)
+	}
+	t.Logf("Storage with snapshot open: %+v", peak)
+
+	if err := snap.Discard(ctx); err != nil {
+		t.Fatalf("Discard: %v", err)
+	}
+	discarded = true
+
+	// Overwrite every key once more, for databases that collect garbage lazily
+	// on writes.
+	tx, err = db.NewTransaction(ctx)
+	if err != nil {
+		t.Fatalf("NewTransaction (final): %v", err)
+	}
+	for i := 0; i < numBaseKeys+numChurnKeys; i++ {
+		key := baseKey(i)
+		if i >= numBaseKeys {
+			key = churnKey(i - numBaseKeys)
+		}
+		if err := tx.Set(ctx, key, strings.NewReader("final")); err != nil {
+			t.Fatalf("Set %q (final): %v", key, err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("Commit (final): %v", err)
+	}
+
+	// At most the latest and one older version of every key may remain, after
+	// giving asynchronous garbage collectors some time.
+	limit := int64(2 * (numBaseKeys + numChurnKeys))
+	var final StorageStats
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(100 * time.Millisecond) {
+		if final, err = reporter.StorageStats(ctx); err != nil {
+			t.Fatalf("StorageStats (final): %v", err)
+		}
+		if final.Versions <= limit || time.Now().After(deadline) {
+			break
+		}
+	}
+	t.Logf("Storage after snapshot is discarded: %+v", final)
+
+	if final.Versions > limit {
+		t.Errorf("%d versions remain after the snapshot is discarded; want at most %d (garbage is not collected)", final.Versions, limit)
+	}
+}
@@ -0,0 +1,152 @@
+package kvtests
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/visvasity/kv"
+)
+
+// TrackingDatabase is a kv.Database wrapper that tracks every transaction and
+// snapshot it hands out, so that callers which never Commit or Rollback a
+// transaction, or never Discard a snapshot, can be found.
+type TrackingDatabase struct {
+	db kv.Database
+
+	mu     sync.Mutex
+	nextID int64
+	live   map[int64]*trackedHandle
+}
+
+// trackedHandle holds the creation details of a live transaction or snapshot.
+type trackedHandle struct {
+	id    int64
+	kind  string
+	stack []byte
+}
+
+// NewTrackingDatabase returns a tracking wrapper for the database.
+func NewTrackingDatabase(db kv.Database) *TrackingDatabase {
+	return &TrackingDatabase{
+		db:   db,
+		live: make(map[int64]*trackedHandle),
+	}
+}
+
+// Unwrap returns the wrapped database.
+func (d *TrackingDatabase) Unwrap() kv.Database {
+	return d.db
+}
+
+// TrackDatabase returns a tracking wrapper for the database that reports all
+// unclosed transactions and snapshots as test errors when the test and all its
+// subtests complete.
+func TrackDatabase(t testing.TB, db kv.Database) kv.Database {
+	d := NewTrackingDatabase(db)
+	t.Cleanup(func() { d.Check(t) })
+	return d
+}
+
+func (d *TrackingDatabase) track(kind string) int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.nextID++
+	d.live[d.nextID] = &trackedHandle{
+		id:    d.nextID,
+		kind:  kind,
+		stack: debug.Stack(),
+	}
+	return d.nextID
+}
+
+func (d *TrackingDatabase) untrack(id int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.live, id)
+}
+
+// NewTransaction creates a tracked transaction. The transaction is tracked
+// until Commit or Rollback is called on it, irrespective of the result.
+func (d *TrackingDatabase) NewTransaction(ctx context.Context) (kv.Transaction, error) {
+	tx, err := d.db.NewTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &trackedTransaction{Transaction: tx, db: d, id: d.track("transaction")}, nil
+}
+
+// NewSnapshot creates a tracked snapshot. The snapshot is tracked until
+// Discard is called on it, irrespective of the result.
+func (d *TrackingDatabase) NewSnapshot(ctx context.Context) (kv.Snapshot, error) {
+	snap, err := d.db.NewSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &trackedSnapshot{Snapshot: snap, db: d, id: d.track("snapshot")}, nil
+}
+
+// Unclosed returns a description of every transaction and snapshot that was
+// not closed yet, along with the stack trace of its creation, in creation
+// order.
+func (d *TrackingDatabase) Unclosed() []string {
+	d.mu.Lock()
+	handles := make([]*trackedHandle, 0, len(d.live))
+	for _, h := range d.live {
+		handles = append(handles, h)
+	}
+	d.mu.Unlock()
+
+	slices.SortFunc(handles, func(a, b *trackedHandle) int { return cmp.Compare(a.id, b.id) })
+
+	var unclosed []string
+	for _, h := range handles {
+		unclosed = append(unclosed, fmt.Sprintf("%s #%d was never closed; created at:\n%s", h.kind, h.id, h.stack))
+	}
+	return unclosed
+}
+
+// Check reports every transaction and snapshot that is not closed yet as an
+// error on t.
+func (d *TrackingDatabase) Check(t testing.TB) {
+	t.Helper()
+
+	for _, s := range d.Unclosed() {
+		t.Error(s)
+	}
+}
+
+type trackedTransaction struct {
+	kv.Transaction
+
+	db *TrackingDatabase
+	id int64
+}
+
+func (t *trackedTransaction) Commit(ctx context.Context) error {
+	defer t.db.untrack(t.id)
+	return t.Transaction.Commit(ctx)
+}
+
+func (t *trackedTransaction) Rollback(ctx context.Context) error {
+	defer t.db.untrack(t.id)
+	return t.Transaction.Rollback(ctx)
+}
+
+type trackedSnapshot struct {
+	kv.Snapshot
+
+	db *TrackingDatabase
+	id int64
+}
+
+func (s *trackedSnapshot) Discard(ctx context.Context) error {
+	defer s.db.untrack(s.id)
+	return s.Snapshot.Discard(ctx)
+}
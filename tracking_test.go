@@ -0,0 +1,71 @@
+package kvtests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/visvasity/kv"
+	"github.com/visvasity/kvmemdb"
+)
+
+// reporter is a database that declares its capabilities.
+type reporter struct {
+	kv.Database
+}
+
+func (reporter) Capabilities() Capabilities {
+	return Capabilities{Serializable: true}
+}
+
+func TestTrackingDatabase(t *testing.T) {
+	ctx := context.Background()
+
+	d := NewTrackingDatabase(kv.DatabaseFrom(kvmemdb.New()))
+
+	tx, err := d.NewTransaction(ctx)
+	if err != nil {
+		t.Fatalf("NewTransaction: %v", err)
+	}
+	snap, err := d.NewSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("NewSnapshot: %v", err)
+	}
+	closed, err := d.NewTransaction(ctx)
+	if err != nil {
+		t.Fatalf("NewTransaction: %v", err)
+	}
+	if err := closed.Rollback(ctx); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+
+	unclosed := d.Unclosed()
+	if len(unclosed) != 2 {
+		t.Fatalf("Unclosed() returned %d handles; want 2:\n%s", len(unclosed), strings.Join(unclosed, "\n"))
+	}
+	for i, want := range []string{"transaction #1 was never closed", "snapshot #2 was never closed"} {
+		if !strings.HasPrefix(unclosed[i], want) {
+			t.Errorf("Unclosed()[%d] = %q; want prefix %q", i, unclosed[i], want)
+		}
+		if !strings.Contains(unclosed[i], "kvtests.TestTrackingDatabase(") {
+			t.Errorf("Unclosed()[%d] doesn't include the stack of the creating test:\n%s", i, unclosed[i])
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if err := snap.Discard(ctx); err != nil {
+		t.Fatalf("Discard: %v", err)
+	}
+	if unclosed := d.Unclosed(); len(unclosed) != 0 {
+		t.Errorf("Unclosed() after closing all handles returned:\n%s", strings.Join(unclosed, "\n"))
+	}
+}
+
+func TestTrackingDatabaseUnwrap(t *testing.T) {
+	d := NewTrackingDatabase(reporter{kv.DatabaseFrom(kvmemdb.New())})
+	if caps := capabilitiesOf(context.Background(), d); !caps.Serializable {
+		t.Errorf("capabilities of the wrapped database were not found through the tracking database")
+	}
+}
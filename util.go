@@ -3,6 +3,8 @@ package kvtests
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"os"
 	"testing"
 
@@ -16,6 +18,22 @@ func warn(t testing.TB, format string, args ...any) {
 	t.Logf("WARNING (cleanup): "+format, args...)
 }
 
+// databaseAs returns the database as a T, looking through wrappers with an
+// Unwrap method that returns the wrapped database, such as DelayDatabase.
+func databaseAs[T any](db kv.Database) (T, bool) {
+	for {
+		if v, ok := any(db).(T); ok {
+			return v, true
+		}
+		u, ok := db.(interface{ Unwrap() kv.Database })
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		db = u.Unwrap()
+	}
+}
+
 // cleanupPrefix deletes all keys under the given prefix using the correct prefix range.
 // Errors are non-fatal (best-effort) but are logged as warnings.
 func cleanupPrefix(ctx context.Context, t testing.TB, db kv.Database, prefix string) {
@@ -51,3 +69,26 @@ func cleanupPrefix(ctx context.Context, t testing.TB, db kv.Database, prefix str
 		warn(t, "cleanupPrefix: final Commit failed: %v", err)
 	}
 }
+
+// checkValue returns a non-nil error if the key doesn't exist or if its value
+// is not equal to want.
+func checkValue(ctx context.Context, g kv.Getter, key, want string) error {
+	r, err := g.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("Get(%q): %w", key, err)
+	}
+	return checkReader(key, r, want)
+}
+
+// checkReader returns a non-nil error if the value read from r for the key is
+// not equal to want.
+func checkReader(key string, r io.Reader, want string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("io.ReadAll(%q): %w", key, err)
+	}
+	if string(data) != want {
+		return fmt.Errorf("key %q has value %q; want %q", key, data, want)
+	}
+	return nil
+}